@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/c9845/hashfs"
+)
+
+// generateData is the data used to build the generated source and test files.
+type generateData struct {
+	Package  string
+	Dir      string //quoted, for use in the test file.
+	Var      string
+	Func     string
+	Test     string
+	Options  string
+	Manifest hashfs.Manifest
+}
+
+// generateSource is the template for the generated source file.
+var generateSource = template.Must(template.New("source").Parse(`// Code generated by "hashfs generate"; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"crypto"
+	"io/fs"
+
+	"github.com/c9845/hashfs"
+)
+
+// {{.Var}} is the precomputed hash of each file in {{.Dir}}.
+//
+// The ContentType is not included since it depends on the MIME types installed on
+// the machine go generate was run on.
+var {{.Var}} = hashfs.Manifest{
+{{- range $originalPath, $entry := .Manifest}}
+	{{printf "%q" $originalPath}}: {HashPath: {{printf "%q" $entry.HashPath}}, Hash: {{printf "%q" $entry.Hash}}, Size: {{$entry.Size}}, Integrity: {{printf "%q" $entry.Integrity}}},
+{{- end}}
+}
+
+// {{.Func}} returns an HFS for fsys with the lookup tables populated from
+// {{.Var}} so that no hashing is done at startup. The fsys must contain the same
+// files as {{.Dir}}, typically via an embed.FS.
+func {{.Func}}(fsys fs.FS) (*hashfs.HFS, error) {
+	return hashfs.NewFSFromManifest(fsys, {{.Var}}, {{.Options}})
+}
+`))
+
+// generateTest is the template for the generated test file.
+var generateTest = template.Must(template.New("test").Parse(`// Code generated by "hashfs generate"; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"crypto"
+	"os"
+	"testing"
+
+	"github.com/c9845/hashfs"
+)
+
+// {{.Test}} fails if the files in {{.Dir}} have changed since {{.Var}} was
+// generated. Run go generate to update {{.Var}}.
+func {{.Test}}(t *testing.T) {
+	hfs := hashfs.NewFS(os.DirFS({{.Dir}}), {{.Options}})
+	err := hfs.HashAll()
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	got := hfs.Manifest()
+	for originalPath, want := range {{.Var}} {
+		g, exists := got[originalPath]
+		if !exists {
+			t.Errorf("%s was removed, run go generate", originalPath)
+		} else if g.HashPath != want.HashPath || g.Hash != want.Hash || g.Size != want.Size || g.Integrity != want.Integrity {
+			t.Errorf("%s was changed, run go generate", originalPath)
+		}
+	}
+	for originalPath := range got {
+		if _, exists := {{.Var}}[originalPath]; !exists {
+			t.Errorf("%s was added, run go generate", originalPath)
+		}
+	}
+}
+`))
+
+// generate writes a Go source file containing the precomputed hash of each file in
+// a directory and a constructor that loads the hashes into an HFS. A test file is
+// also written that fails if the files in the directory no longer match the
+// generated hashes.
+//
+// This is meant to be called via go:generate, for example:
+//
+//	//go:generate go run github.com/c9845/hashfs/cmd/hashfs generate static
+func generate(args []string, stdout io.Writer) error {
+	var (
+		o   hashOptions
+		d   generateData
+		out string
+		pkg string
+	)
+	flags := flag.NewFlagSet("generate", flag.ContinueOnError)
+	o.register(flags)
+	flags.StringVar(&out, "out", "hashfs_gen.go", "file to write the generated source to; the test is written alongside with a _test.go suffix")
+	flags.StringVar(&pkg, "pkg", os.Getenv("GOPACKAGE"), "package name of the generated files; defaults to $GOPACKAGE set by go generate")
+	flags.StringVar(&d.Var, "var", "hashfsManifest", "name of the generated manifest variable")
+	flags.StringVar(&d.Func, "func", "newHashFS", "name of the generated constructor func")
+
+	dir, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+	if pkg == "" {
+		return errors.New("-pkg must be provided when not run via go generate")
+	}
+	if !token.IsIdentifier(pkg) {
+		return fmt.Errorf("-pkg must be a valid Go identifier, got %q", pkg)
+	}
+	if !token.IsIdentifier(d.Var) {
+		return fmt.Errorf("-var must be a valid Go identifier, got %q", d.Var)
+	}
+	if !token.IsIdentifier(d.Func) {
+		return fmt.Errorf("-func must be a valid Go identifier, got %q", d.Func)
+	}
+
+	hfs, err := newFS(dir, o)
+	if err != nil {
+		return err
+	}
+
+	d.Package = pkg
+	d.Dir = strconv.Quote(filepath.ToSlash(dir))
+	d.Test = "Test" + strings.ToUpper(d.Func[:1]) + d.Func[1:]
+	d.Options = strings.Join(o.source(), ", ")
+	d.Manifest = hfs.Manifest()
+
+	err = writeTemplate(out, generateSource, d)
+	if err != nil {
+		return err
+	}
+
+	testOut := strings.TrimSuffix(out, ".go") + "_test.go"
+	err = writeTemplate(testOut, generateTest, d)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(stdout, out)
+	fmt.Fprintln(stdout, testOut)
+	return nil
+}
+
+// writeTemplate executes the template, formats the result as Go source, and writes
+// it to the file at path.
+func writeTemplate(path string, t *template.Template, d generateData) error {
+	var b bytes.Buffer
+	err := t.Execute(&b, d)
+	if err != nil {
+		return err
+	}
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, src, 0644)
+}
@@ -0,0 +1,511 @@
+/*
+Command hashfs generates the same hash paths for a directory of static files that
+the hashfs package generates at runtime. This is useful for CI and deploy scripts
+that need to know, or create, the files the server will expect.
+
+Usage:
+
+	hashfs <command> [flags] <directory>
+
+Commands:
+  - manifest: print the manifest, as JSON, for the directory.
+  - ls: print a table of original path, hash path, size, and hash for each file.
+  - verify: re-hash each file and compare against a manifest.
+  - export: write a copy of each file, using the hash path, to an output directory.
+  - generate: write a Go source file, and test, containing the precomputed hash of
+    each file for use with go:generate.
+
+Each command accepts the -location, -algo, -encoding, -pattern, -length, -integrity,
+-rewrite-css, and -rewrite-js flags which match the HashLocationX, HashWith,
+HashEncoding, FilenamePattern, HashLength, IntegrityAlgo, RewriteCSS, and RewriteJS
+options to hashfs.NewFS. Use the same values you use in your server so the generated hash paths
+match.
+*/
+package main
+
+import (
+	"crypto"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/c9845/hashfs"
+)
+
+// usage is printed when an unknown command is provided or no command is provided.
+const usage = `Usage: hashfs <command> [flags] <directory>
+
+Commands:
+  manifest  print the manifest, as JSON, for the directory
+  ls        print the original path, hash path, size, and hash of each file
+  verify    re-hash each file and compare against a manifest
+  export    write a copy of each file, using the hash path, to an output directory
+  generate  write a Go source file, and test, containing the hash of each file
+
+Run "hashfs <command> -h" for the flags of each command.
+`
+
+// errVerifyFailed is returned when the verify command finds differences between
+// the manifest and the directory.
+var errVerifyFailed = errors.New("verification failed")
+
+func main() {
+	err := run(os.Args[1:], os.Stdout)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "hashfs:", err)
+		os.Exit(1)
+	}
+}
+
+// run handles parsing the command and flags and running the command. This is
+// separated from main for testing.
+func run(args []string, stdout io.Writer) error {
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return flag.ErrHelp
+	}
+
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "manifest":
+		return manifest(args, stdout)
+	case "ls":
+		return ls(args, stdout)
+	case "verify":
+		return verify(args, stdout)
+	case "export":
+		return export(args, stdout)
+	case "generate":
+		return generate(args, stdout)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+// hashOptions stores the flags that map to options to hashfs.NewFS. These flags
+// are shared by every command.
+type hashOptions struct {
+	location      string
+	algo          string
+	encoding      string
+	pattern       string
+	length        uint
+	integrityAlgo string
+	rewriteCSS    bool
+	rewriteJS     bool
+}
+
+// register adds the flags for the hash options to a command's flag set.
+func (o *hashOptions) register(flags *flag.FlagSet) {
+	flags.StringVar(&o.location, "location", "end", "location of the hash in the path; start, end, first-period, directory, tree, or query")
+	flags.StringVar(&o.algo, "algo", "sha256", "hash algorithm; sha256, sha1, sha512, sha512/256, md5, fnv1a-64, fnv1a-128, or crc64")
+	flags.StringVar(&o.encoding, "encoding", "hex", "hash encoding; hex, base32, base36, base62, or base64url")
+	flags.StringVar(&o.pattern, "pattern", "", "filename pattern, i.e. [name].[hash:8].[ext]; overrides -location")
+	flags.UintVar(&o.length, "length", 0, "length to trim the hash to; 0 uses the full hash")
+	flags.StringVar(&o.integrityAlgo, "integrity", "sha384", "subresource integrity algorithm; sha256, sha384, or sha512")
+	flags.BoolVar(&o.rewriteCSS, "rewrite-css", false, "rewrite references to other files in CSS files")
+	flags.BoolVar(&o.rewriteJS, "rewrite-js", false, "rewrite import specifiers and sourceMappingURLs in JavaScript files")
+}
+
+// options translates the flags into a single option for hashfs.NewFS that applies
+// each option.
+//
+// A single option is returned, rather than a slice, since the type of hashfs.NewFS's
+// options is unexported and thus a slice of options cannot be passed to it.
+func (o *hashOptions) options() (func(*hashfs.HFS), error) {
+	location, err := o.hashLocation()
+	if err != nil {
+		return nil, err
+	}
+	algo, err := o.hashAlgo()
+	if err != nil {
+		return nil, err
+	}
+	encoding, ok := encodings[o.encoding]
+	if !ok {
+		return nil, fmt.Errorf("unknown hash encoding %q", o.encoding)
+	}
+
+	integrityAlgo, err := o.integrity()
+	if err != nil {
+		return nil, err
+	}
+
+	options := []func(*hashfs.HFS){location, algo, hashfs.HashEncoding(encoding.encoding), hashfs.HashLength(o.length), integrityAlgo}
+	if o.pattern != "" {
+		err := hashfs.ValidateFilenamePattern(o.pattern)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, hashfs.FilenamePattern(o.pattern))
+	}
+	if o.rewriteCSS {
+		options = append(options, hashfs.RewriteCSS())
+	}
+	if o.rewriteJS {
+		options = append(options, hashfs.RewriteJS())
+	}
+
+	return func(hfs *hashfs.HFS) {
+		for _, option := range options {
+			option(hfs)
+		}
+	}, nil
+}
+
+// hashLocation translates the -location flag into an option for hashfs.NewFS.
+func (o *hashOptions) hashLocation() (func(*hashfs.HFS), error) {
+	switch o.location {
+	case "start":
+		return hashfs.HashLocationStart(), nil
+	case "end":
+		return hashfs.HashLocationEnd(), nil
+	case "first-period":
+		return hashfs.HashLocationFirstPeriod(), nil
+	case "directory":
+		return hashfs.HashLocationDirectory(), nil
+	case "tree":
+		return hashfs.HashLocationTree(), nil
+	case "query":
+		return hashfs.QueryStringMode(), nil
+	default:
+		return nil, fmt.Errorf("unknown hash location %q", o.location)
+	}
+}
+
+// hashAlgo translates the -algo flag into an option for hashfs.NewFS.
+func (o *hashOptions) hashAlgo() (func(*hashfs.HFS), error) {
+	h, ok := hashers[o.algo]
+	if !ok {
+		return nil, fmt.Errorf("unknown hash algorithm %q", o.algo)
+	}
+
+	return hashfs.HashWith(h.hasher), nil
+}
+
+// hashers are the Hashers that can be chosen with the -algo flag, keyed by name,
+// along with the name of the exported variable for generating code.
+var hashers = map[string]struct {
+	hasher hashfs.Hasher
+	source string
+}{
+	hashfs.HasherSHA256.Name():     {hashfs.HasherSHA256, "hashfs.HasherSHA256"},
+	hashfs.HasherSHA1.Name():       {hashfs.HasherSHA1, "hashfs.HasherSHA1"},
+	hashfs.HasherSHA512.Name():     {hashfs.HasherSHA512, "hashfs.HasherSHA512"},
+	hashfs.HasherSHA512_256.Name(): {hashfs.HasherSHA512_256, "hashfs.HasherSHA512_256"},
+	hashfs.HasherMD5.Name():        {hashfs.HasherMD5, "hashfs.HasherMD5"},
+	hashfs.HasherFNV1a64.Name():    {hashfs.HasherFNV1a64, "hashfs.HasherFNV1a64"},
+	hashfs.HasherFNV1a128.Name():   {hashfs.HasherFNV1a128, "hashfs.HasherFNV1a128"},
+	hashfs.HasherCRC64.Name():      {hashfs.HasherCRC64, "hashfs.HasherCRC64"},
+}
+
+// encodings are the hash encodings that can be chosen with the -encoding flag, along
+// with the name of the exported constant for generating code.
+var encodings = map[string]struct {
+	encoding hashfs.Encoding
+	source   string
+}{
+	"hex":       {hashfs.EncodingHex, "hashfs.EncodingHex"},
+	"base32":    {hashfs.EncodingBase32, "hashfs.EncodingBase32"},
+	"base36":    {hashfs.EncodingBase36, "hashfs.EncodingBase36"},
+	"base62":    {hashfs.EncodingBase62, "hashfs.EncodingBase62"},
+	"base64url": {hashfs.EncodingBase64URL, "hashfs.EncodingBase64URL"},
+}
+
+// integrity translates the -integrity flag into an option for hashfs.NewFS.
+func (o *hashOptions) integrity() (func(*hashfs.HFS), error) {
+	switch o.integrityAlgo {
+	case "sha256":
+		return hashfs.IntegrityAlgo(crypto.SHA256), nil
+	case "sha384":
+		return hashfs.IntegrityAlgo(crypto.SHA384), nil
+	case "sha512":
+		return hashfs.IntegrityAlgo(crypto.SHA512), nil
+	default:
+		return nil, fmt.Errorf("unknown integrity algorithm %q", o.integrityAlgo)
+	}
+}
+
+// source returns the Go source code for the options to hashfs.NewFS. This is used
+// when generating code. The options must have already been validated.
+func (o *hashOptions) source() []string {
+	locations := map[string]string{
+		"start":        "hashfs.HashLocationStart()",
+		"end":          "hashfs.HashLocationEnd()",
+		"first-period": "hashfs.HashLocationFirstPeriod()",
+		"directory":    "hashfs.HashLocationDirectory()",
+		"tree":         "hashfs.HashLocationTree()",
+		"query":        "hashfs.QueryStringMode()",
+	}
+	integrityAlgos := map[string]string{
+		"sha256": "hashfs.IntegrityAlgo(crypto.SHA256)",
+		"sha384": "hashfs.IntegrityAlgo(crypto.SHA384)",
+		"sha512": "hashfs.IntegrityAlgo(crypto.SHA512)",
+	}
+
+	options := []string{
+		locations[o.location],
+		"hashfs.HashWith(" + hashers[o.algo].source + ")",
+		"hashfs.HashEncoding(" + encodings[o.encoding].source + ")",
+		"hashfs.HashLength(" + strconv.FormatUint(uint64(o.length), 10) + ")",
+		integrityAlgos[o.integrityAlgo],
+	}
+	if o.pattern != "" {
+		options = append(options, "hashfs.FilenamePattern("+strconv.Quote(o.pattern)+")")
+	}
+	if o.rewriteCSS {
+		options = append(options, "hashfs.RewriteCSS()")
+	}
+	if o.rewriteJS {
+		options = append(options, "hashfs.RewriteJS()")
+	}
+
+	return options
+}
+
+// parse parses the flags for a command and returns the directory argument.
+func parse(flags *flag.FlagSet, args []string) (dir string, err error) {
+	err = flags.Parse(args)
+	if err != nil {
+		return
+	}
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return "", errors.New("a single directory must be provided")
+	}
+
+	return flags.Arg(0), nil
+}
+
+// newFS returns an HFS with every file in the directory hashed.
+func newFS(dir string, o hashOptions) (*hashfs.HFS, error) {
+	options, err := o.options()
+	if err != nil {
+		return nil, err
+	}
+
+	hfs := hashfs.NewFS(os.DirFS(dir), options)
+	err = hfs.HashAll()
+	if err != nil {
+		return nil, err
+	}
+
+	return hfs, nil
+}
+
+// sortedPaths returns the original paths in a manifest in sorted order so that
+// output is consistent.
+func sortedPaths(m hashfs.Manifest) (originalPaths []string) {
+	originalPaths = make([]string, 0, len(m))
+	for originalPath := range m {
+		originalPaths = append(originalPaths, originalPath)
+	}
+	sort.Strings(originalPaths)
+
+	return
+}
+
+// manifest prints the manifest for a directory.
+func manifest(args []string, stdout io.Writer) error {
+	var (
+		o    hashOptions
+		vite bool
+	)
+	flags := flag.NewFlagSet("manifest", flag.ContinueOnError)
+	o.register(flags)
+	flags.BoolVar(&vite, "vite", false, "print the manifest in the same format as Vite's manifest.json")
+
+	dir, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+
+	hfs, err := newFS(dir, o)
+	if err != nil {
+		return err
+	}
+
+	if vite {
+		return hfs.WriteViteManifest(stdout)
+	}
+	return hfs.WriteManifest(stdout)
+}
+
+// ls prints a table of the files in a directory.
+func ls(args []string, stdout io.Writer) error {
+	var o hashOptions
+	flags := flag.NewFlagSet("ls", flag.ContinueOnError)
+	o.register(flags)
+
+	dir, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+
+	hfs, err := newFS(dir, o)
+	if err != nil {
+		return err
+	}
+
+	m := hfs.Manifest()
+
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ORIGINAL PATH\tHASH PATH\tSIZE\tHASH")
+	for _, originalPath := range sortedPaths(m) {
+		entry := m[originalPath]
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", originalPath, entry.HashPath, entry.Size, entry.Hash)
+	}
+
+	return tw.Flush()
+}
+
+// verify re-hashes the files in a directory and compares the results against a
+// manifest. Every difference is printed and an error is returned if any difference
+// exists.
+func verify(args []string, stdout io.Writer) error {
+	var (
+		o            hashOptions
+		manifestPath string
+	)
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	o.register(flags)
+	flags.StringVar(&manifestPath, "manifest", "", "path to the manifest to verify against")
+
+	dir, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+	if manifestPath == "" {
+		return errors.New("-manifest must be provided")
+	}
+
+	f, err := os.Open(manifestPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	want, err := hashfs.ReadManifest(f)
+	if err != nil {
+		return err
+	}
+
+	hfs, err := newFS(dir, o)
+	if err != nil {
+		return err
+	}
+	got := hfs.Manifest()
+
+	//Compare.
+	differences := 0
+	for _, originalPath := range sortedPaths(want) {
+		g, exists := got[originalPath]
+		if !exists {
+			fmt.Fprintf(stdout, "missing: %s\n", originalPath)
+			differences++
+			continue
+		}
+
+		if w := want[originalPath]; g.HashPath != w.HashPath || g.Hash != w.Hash {
+			fmt.Fprintf(stdout, "changed: %s (%s != %s)\n", originalPath, w.HashPath, g.HashPath)
+			differences++
+		}
+	}
+	for _, originalPath := range sortedPaths(got) {
+		if _, exists := want[originalPath]; !exists {
+			fmt.Fprintf(stdout, "unlisted: %s\n", originalPath)
+			differences++
+		}
+	}
+
+	if differences > 0 {
+		return fmt.Errorf("%w, %d differences", errVerifyFailed, differences)
+	}
+
+	fmt.Fprintf(stdout, "ok: %d files\n", len(want))
+	return nil
+}
+
+// export writes a copy of each file in a directory, named using the hash path, to an
+// output directory. The directory structure is retained.
+func export(args []string, stdout io.Writer) error {
+	var (
+		o   hashOptions
+		out string
+	)
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	o.register(flags)
+	flags.StringVar(&out, "out", "", "directory to write hashed copies of files to")
+
+	dir, err := parse(flags, args)
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		return errors.New("-out must be provided")
+	}
+
+	hfs, err := newFS(dir, o)
+	if err != nil {
+		return err
+	}
+
+	m := hfs.Manifest()
+	for _, originalPath := range sortedPaths(m) {
+		hashPath := m[originalPath].HashPath
+
+		//The file is opened via the hash path so that rewritten contents, which the
+		//hash was calculated from, are copied rather than the on-disk contents.
+		//
+		//The hash is in the query string, rather than the filename, when -location
+		//query is used, so the file keeps its original name.
+		name, _, _ := strings.Cut(hashPath, "?")
+		err := copyFile(hfs, hashPath, filepath.Join(out, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(stdout, hashPath)
+	}
+
+	return nil
+}
+
+// copyFile copies the file at name in fsys to dst, creating any needed directories.
+func copyFile(fsys fs.FS, name, dst string) error {
+	src, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	err = os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, src)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/c9845/hashfs"
+)
+
+// testdata is the directory of files used for testing, shared with the hashfs
+// package's tests.
+const testdata = "../../testdata"
+
+// scriptjs is the sha256 hash of testdata/subdir1/script.js.
+const scriptjs = "e959523c7cd6350c847a50ba64d1876900e1ee9dcf3b6c4abb8a6b8e6c13b262"
+
+func TestLs(t *testing.T) {
+	var b bytes.Buffer
+	err := run([]string{"ls", "-location", "start", testdata}, &b)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	want := "subdir1/" + scriptjs + "-script.js"
+	if !strings.Contains(b.String(), want) {
+		t.Fatalf("hash path missing from output; \ngot:  %s, \nwant: %s", b.String(), want)
+		return
+	}
+}
+
+func TestLsPattern(t *testing.T) {
+	var b bytes.Buffer
+	err := run([]string{"ls", "-pattern", "[name].[hash:8].[ext]", testdata}, &b)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	want := "subdir1/script." + scriptjs[:8] + ".js"
+	if !strings.Contains(b.String(), want) {
+		t.Fatalf("hash path missing from output; \ngot:  %s, \nwant: %s", b.String(), want)
+		return
+	}
+}
+
+func TestLsDirectory(t *testing.T) {
+	var b bytes.Buffer
+	err := run([]string{"ls", "-location", "directory", testdata}, &b)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	want := scriptjs + "/subdir1/script.js"
+	if !strings.Contains(b.String(), want) {
+		t.Fatalf("hash path missing from output; \ngot:  %s, \nwant: %s", b.String(), want)
+		return
+	}
+}
+
+func TestLsQueryString(t *testing.T) {
+	var b bytes.Buffer
+	err := run([]string{"ls", "-location", "query", testdata}, &b)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	want := "subdir1/script.js?v=" + scriptjs
+	if !strings.Contains(b.String(), want) {
+		t.Fatalf("hash path missing from output; \ngot:  %s, \nwant: %s", b.String(), want)
+		return
+	}
+}
+
+func TestBadOptions(t *testing.T) {
+	var b bytes.Buffer
+	err := run([]string{"ls", "-location", "middle", testdata}, &b)
+	if err == nil {
+		t.Fatal("expected error for unknown hash location")
+		return
+	}
+
+	err = run([]string{"ls", "-algo", "sha3", testdata}, &b)
+	if err == nil {
+		t.Fatal("expected error for unknown hash algorithm")
+		return
+	}
+
+	err = run([]string{"ls", "-encoding", "base58", testdata}, &b)
+	if err == nil {
+		t.Fatal("expected error for unknown hash encoding")
+		return
+	}
+
+	err = run([]string{"ls", "-pattern", "[name].[ext]", testdata}, &b)
+	if err == nil {
+		t.Fatal("expected error for invalid filename pattern")
+		return
+	}
+
+	err = run([]string{"unknown", testdata}, &b)
+	if err == nil {
+		t.Fatal("expected error for unknown command")
+		return
+	}
+}
+
+func TestVerify(t *testing.T) {
+	//Write a manifest to verify against.
+	var b bytes.Buffer
+	err := run([]string{"manifest", testdata}, &b)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+	err = os.WriteFile(manifestPath, b.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	t.Run("Match", func(t *testing.T) {
+		var b bytes.Buffer
+		err := run([]string{"verify", "-manifest", manifestPath, testdata}, &b)
+		if err != nil {
+			t.Fatal(err, b.String())
+			return
+		}
+	})
+
+	t.Run("DifferentOptions", func(t *testing.T) {
+		var b bytes.Buffer
+		err := run([]string{"verify", "-manifest", manifestPath, "-length", "8", testdata}, &b)
+		if !errors.Is(err, errVerifyFailed) {
+			t.Fatal("expected verification to fail", err)
+			return
+		}
+		if !strings.Contains(b.String(), "changed: subdir1/script.js") {
+			t.Fatal("expected changed file to be reported", b.String())
+			return
+		}
+	})
+}
+
+func TestExport(t *testing.T) {
+	out := t.TempDir()
+
+	var b bytes.Buffer
+	err := run([]string{"export", "-out", out, testdata}, &b)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	got, err := os.ReadFile(filepath.Join(out, "subdir1", "script.js-"+scriptjs+".js"))
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	want, err := os.ReadFile(filepath.Join(testdata, "subdir1", "script.js"))
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("bad content; \ngot:  %s, \nwant: %s", got, want)
+		return
+	}
+}
+
+func TestExportQueryString(t *testing.T) {
+	out := t.TempDir()
+
+	var b bytes.Buffer
+	err := run([]string{"export", "-location", "query", "-out", out, testdata}, &b)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	//The file keeps its original name since the hash is in the query string.
+	got, err := os.ReadFile(filepath.Join(out, "subdir1", "script.js"))
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	want, err := os.ReadFile(filepath.Join(testdata, "subdir1", "script.js"))
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("bad content; \ngot:  %s, \nwant: %s", got, want)
+		return
+	}
+
+	entries, err := os.ReadDir(filepath.Join(out, "subdir1"))
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	for _, e := range entries {
+		if strings.Contains(e.Name(), "?") {
+			t.Fatal("file names should not include the query string", e.Name())
+			return
+		}
+	}
+}
+
+func TestExportRewrite(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"css/s.css":     `@font-face { src: url(../fonts/a.woff2); }`,
+		"fonts/a.woff2": "woff2",
+		"js/app.js":     `import { b } from "./b.js";`,
+		"js/b.js":       `export const b = 1;`,
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+			return
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+			return
+		}
+	}
+
+	out := t.TempDir()
+	var b bytes.Buffer
+	err := run([]string{"export", "-rewrite-css", "-rewrite-js", "-out", out, dir}, &b)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	hfs := hashfs.NewFS(os.DirFS(dir), hashfs.RewriteCSS(), hashfs.RewriteJS())
+	tests := []struct {
+		originalPath string
+		reference    string
+	}{
+		{"css/s.css", "fonts/a.woff2"},
+		{"js/app.js", "js/b.js"},
+	}
+	for _, tt := range tests {
+		hashPath := hfs.GetHashPath(tt.originalPath)
+		got, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(hashPath)))
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		//The exported file must contain the rewritten reference.
+		want := path.Base(hfs.GetHashPath(tt.reference))
+		if !strings.Contains(string(got), want) {
+			t.Fatalf("exported file not rewritten; \ngot:  %s, \nwant: %s", got, want)
+			return
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "hashfs_gen.go")
+
+	var b bytes.Buffer
+	err := run([]string{"generate", "-pkg", "static", "-out", out, "-func", "newStaticFS", testdata}, &b)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	src, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	for _, want := range []string{
+		"package static",
+		`{HashPath: "subdir1/script.js-` + scriptjs + `.js"`,
+		"func newStaticFS(fsys fs.FS) (*hashfs.HFS, error)",
+	} {
+		if !strings.Contains(string(src), want) {
+			t.Fatalf("generated source missing %s; \ngot: %s", want, src)
+			return
+		}
+	}
+
+	test, err := os.ReadFile(strings.TrimSuffix(out, ".go") + "_test.go")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+	if !strings.Contains(string(test), "func TestNewStaticFS(t *testing.T)") {
+		t.Fatalf("generated test missing test func; \ngot: %s", test)
+		return
+	}
+
+	//The ContentType depends on the machine's MIME types, so it must not be part of
+	//the generated table or the drift check.
+	if strings.Contains(string(src), "ContentType:") {
+		t.Fatalf("generated source should not include ContentType; \ngot: %s", src)
+		return
+	}
+	if strings.Contains(string(test), "g != want") {
+		t.Fatalf("generated test should not compare whole entries; \ngot: %s", test)
+		return
+	}
+
+	//Package name is required.
+	err = run([]string{"generate", "-pkg", "", "-out", out, testdata}, &b)
+	if err == nil {
+		t.Fatal("expected error for missing package name")
+		return
+	}
+
+	//Names must be valid identifiers.
+	for _, flags := range [][]string{
+		{"-func", ""},
+		{"-func", "new-fs"},
+		{"-var", "1manifest"},
+		{"-pkg", "static files"},
+	} {
+		args := append([]string{"generate", "-pkg", "static", "-out", out}, flags...)
+		err = run(append(args, testdata), &b)
+		if err == nil {
+			t.Fatal("expected error for invalid identifier", flags)
+			return
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package hashfs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+const (
+	//compressMinSize is the smallest file, in bytes, that will be compressed
+	//on-the-fly. Smaller files are not worth the overhead.
+	compressMinSize = 1024
+
+	//compressCacheSizeDefault is the default maximum size, in bytes, of the cache
+	//of compressed files.
+	compressCacheSizeDefault = 32 << 20
+)
+
+// compressibleTypes are the media types, other than text/*, that will be compressed
+// on-the-fly. Formats that are already compressed, such as most images and fonts,
+// are not listed since compressing them again is wasted work.
+var compressibleTypes = map[string]bool{
+	"application/javascript":    true,
+	"application/json":          true,
+	"application/manifest+json": true,
+	"application/wasm":          true,
+	"application/xml":           true,
+	"image/svg+xml":             true,
+}
+
+// Compress enables gzip compressing files on-the-fly when FileServer serves a hash
+// path. Only compressible content types (CSS, JS, SVG, JSON, etc.) larger than 1KB
+// are compressed, and only if a precompressed version of the file does not exist.
+//
+// Since hashed files are immutable, each file is only compressed the first time it
+// is requested and the compressed bytes are cached in memory. The cache will hold
+// about cacheSize bytes; once full, files not already cached are served without
+// compression. If 0 is provided, the default cache size of 32MB is used.
+func Compress(cacheSize uint) optionFunc {
+	return func(hfs *HFS) {
+		if cacheSize == 0 {
+			cacheSize = compressCacheSizeDefault
+		}
+
+		hfs.compressCacheSize = cacheSize
+		hfs.compressCache = make(map[string][]byte)
+	}
+}
+
+// memFile is an fs.File, and io.ReadSeeker, serving bytes from memory. This is used
+// to serve cached compressed bytes the same way a file from the fs.FS is served.
+type memFile struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (m *memFile) Stat() (fs.FileInfo, error) { return m.info, nil }
+func (m *memFile) Close() error               { return nil }
+
+// memFileInfo overrides the size of a file's info to match the bytes stored in a
+// memFile.
+type memFileInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (m memFileInfo) Size() int64 { return m.size }
+
+// newMemFile returns a memFile serving b with the info of the file b was created
+// from.
+func newMemFile(b []byte, info fs.FileInfo) *memFile {
+	return &memFile{
+		Reader: bytes.NewReader(b),
+		info:   memFileInfo{info, int64(len(b))},
+	}
+}
+
+// compressed returns the gzip compressed version of the file f, at originalPath, if
+// on-the-fly compression is enabled, the file is compressible, and the browser
+// accepts gzip. The compressed bytes are cached, by hashPath, for future requests.
+// The Content-Encoding, Content-Type, and Vary headers are set as needed.
+//
+// A nil file is returned if the file should be served as usual. If a non-nil file
+// is returned with a blank encoding, f was read but not worth compressing and the
+// returned file must be served in place of f. If an error is returned, f may have
+// been partially read and cannot be served.
+func (hfs *HFS) compressed(w http.ResponseWriter, r *http.Request, hashPath, originalPath string, f fs.File, info fs.FileInfo) (cf fs.File, cinfo fs.FileInfo, encoding string, err error) {
+	if hfs.compressCacheSize == 0 {
+		return
+	}
+	if info.Size() < compressMinSize || !compressible(originalPath) {
+		return
+	}
+
+	//The response now depends on the Accept-Encoding header.
+	addVaryAcceptEncoding(w)
+
+	if negotiateEncoding(r.Header.Get("Accept-Encoding"), []string{"gzip"}) == "" {
+		return
+	}
+
+	//Check if the file has already been compressed. A nil entry means the file
+	//was previously found to not be worth compressing, or not to fit in the cache.
+	hfs.compressMu.Lock()
+	b, exists := hfs.compressCache[hashPath]
+	hfs.compressMu.Unlock()
+	if exists && b == nil {
+		return
+	} else if exists {
+		setEncodingHeaders(w, originalPath, "gzip")
+		cf = newMemFile(b, info)
+		cinfo, _ = cf.Stat()
+		return cf, cinfo, "gzip", nil
+	}
+
+	//Don't compress files that cannot be cached since they would have to be
+	//compressed on every request.
+	hfs.compressMu.Lock()
+	full := hfs.compressCacheUsed >= hfs.compressCacheSize
+	hfs.compressMu.Unlock()
+	if full {
+		return
+	}
+
+	//Compress the file.
+	//
+	//On error, the file may have been partially read so it cannot be served as
+	//usual. An error is returned so that an error can be served instead.
+	original, err := io.ReadAll(f)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	var buf bytes.Buffer
+	gw, _ := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	gw.Write(original)
+	gw.Close()
+
+	//Don't bother serving compressed bytes if they aren't smaller. The original
+	//bytes must be served since f has already been read.
+	if buf.Len() >= len(original) {
+		hfs.compressMu.Lock()
+		hfs.compressCache[hashPath] = nil
+		hfs.compressMu.Unlock()
+
+		cf = newMemFile(original, info)
+		cinfo, _ = cf.Stat()
+		return cf, cinfo, "", nil
+	}
+
+	//Cache the compressed bytes, if there is room. If there isn't room, the file
+	//is marked so that it isn't compressed again on every request; it will be
+	//served uncompressed from now on.
+	b = buf.Bytes()
+	hfs.compressMu.Lock()
+	if hfs.compressCacheUsed+uint(len(b)) <= hfs.compressCacheSize {
+		hfs.compressCache[hashPath] = b
+		hfs.compressCacheUsed += uint(len(b))
+	} else {
+		hfs.compressCache[hashPath] = nil
+	}
+	hfs.compressMu.Unlock()
+
+	setEncodingHeaders(w, originalPath, "gzip")
+	cf = newMemFile(b, info)
+	cinfo, _ = cf.Stat()
+	return cf, cinfo, "gzip", nil
+}
+
+// compressible returns true if the file at originalPath is a type that is worth
+// compressing, based on the file's extension.
+func compressible(originalPath string) bool {
+	mediaType, _, _ := strings.Cut(mime.TypeByExtension(path.Ext(originalPath)), ";")
+	mediaType = strings.TrimSpace(mediaType)
+
+	return strings.HasPrefix(mediaType, "text/") || compressibleTypes[mediaType]
+}
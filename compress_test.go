@@ -0,0 +1,195 @@
+package hashfs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCompress(t *testing.T) {
+	css := strings.Repeat("body { color: pink; }\n", 100)
+	random := make([]byte, 2048)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	mfs := fstest.MapFS{
+		"styles.css":    {Data: []byte(css)},
+		"small.css":     {Data: []byte("body { color: pink; }")},
+		"image.png":     {Data: []byte(css)},
+		"random.txt":    {Data: random},
+		"precomp.js":    {Data: []byte(css)},
+		"precomp.js.gz": {Data: []byte("gzip")},
+	}
+
+	get := func(hfs *HFS, p, acceptEncoding string) *http.Response {
+		r := httptest.NewRequest("GET", "/"+p, nil)
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+		w := httptest.NewRecorder()
+		FileServer(hfs).ServeHTTP(w, r)
+		return w.Result()
+	}
+
+	t.Run("Gzip", func(t *testing.T) {
+		hfs := NewFS(mfs, Compress(0))
+		hashPath := hfs.GetHashPath("styles.css")
+		hash := hfs.hashPathReverse[hashPath].hash
+
+		//Request twice, the second from the cache.
+		for i := 0; i < 2; i++ {
+			res := get(hfs, hashPath, "gzip, deflate")
+			if res.StatusCode != http.StatusOK {
+				t.Fatal("bad code", res.StatusCode)
+				return
+			}
+			if got := res.Header.Get("Content-Encoding"); got != "gzip" {
+				t.Fatalf("bad content-encoding; \ngot:  %s, \nwant: %s", got, "gzip")
+				return
+			}
+			if got := res.Header.Get("Content-Type"); got != "text/css; charset=utf-8" {
+				t.Fatalf("bad content-type; \ngot:  %s, \nwant: %s", got, "text/css; charset=utf-8")
+				return
+			}
+			if got := res.Header.Get("ETag"); got != `"`+hash+`-gzip"` {
+				t.Fatalf("bad etag; \ngot:  %s, \nwant: %s", got, `"`+hash+`-gzip"`)
+				return
+			}
+
+			gr, err := gzip.NewReader(res.Body)
+			if err != nil {
+				t.Fatal(err)
+				return
+			}
+			body, err := io.ReadAll(gr)
+			if err != nil {
+				t.Fatal(err)
+				return
+			}
+			if string(body) != css {
+				t.Fatal("bad decompressed content")
+				return
+			}
+		}
+
+		if _, exists := hfs.compressCache[hashPath]; !exists {
+			t.Fatal("compressed bytes not cached")
+			return
+		}
+	})
+
+	t.Run("NotAccepted", func(t *testing.T) {
+		hfs := NewFS(mfs, Compress(0))
+		hashPath := hfs.GetHashPath("styles.css")
+
+		res := get(hfs, hashPath, "")
+		if got := res.Header.Get("Content-Encoding"); got != "" {
+			t.Fatalf("bad content-encoding; \ngot:  %s, \nwant: %s", got, "")
+			return
+		}
+		if got := res.Header.Get("Vary"); got != "Accept-Encoding" {
+			t.Fatalf("bad vary; \ngot:  %s, \nwant: %s", got, "Accept-Encoding")
+			return
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		hfs := NewFS(mfs)
+		res := get(hfs, hfs.GetHashPath("styles.css"), "gzip")
+		if got := res.Header.Get("Content-Encoding"); got != "" {
+			t.Fatalf("bad content-encoding; \ngot:  %s, \nwant: %s", got, "")
+			return
+		}
+	})
+
+	t.Run("Skipped", func(t *testing.T) {
+		hfs := NewFS(mfs, Compress(0))
+
+		for _, p := range []string{"small.css", "image.png"} {
+			res := get(hfs, hfs.GetHashPath(p), "gzip")
+			if got := res.Header.Get("Content-Encoding"); got != "" {
+				t.Fatalf("bad content-encoding for %s; \ngot:  %s, \nwant: %s", p, got, "")
+				return
+			}
+		}
+	})
+
+	t.Run("NotWorthIt", func(t *testing.T) {
+		hfs := NewFS(mfs, Compress(0))
+		hashPath := hfs.GetHashPath("random.txt")
+
+		for i := 0; i < 2; i++ {
+			res := get(hfs, hashPath, "gzip")
+			if got := res.Header.Get("Content-Encoding"); got != "" {
+				t.Fatalf("bad content-encoding; \ngot:  %s, \nwant: %s", got, "")
+				return
+			}
+
+			body, _ := io.ReadAll(res.Body)
+			if !bytes.Equal(body, random) {
+				t.Fatal("bad content")
+				return
+			}
+		}
+	})
+
+	t.Run("PreferPrecompressed", func(t *testing.T) {
+		hfs := NewFS(mfs, Compress(0))
+
+		res := get(hfs, hfs.GetHashPath("precomp.js"), "gzip")
+		body, _ := io.ReadAll(res.Body)
+		if string(body) != "gzip" {
+			t.Fatalf("bad content; \ngot:  %s, \nwant: %s", body, "gzip")
+			return
+		}
+	})
+
+	t.Run("CacheFull", func(t *testing.T) {
+		hfs := NewFS(mfs, Compress(1))
+		hashPath := hfs.GetHashPath("styles.css")
+
+		//Compressed bytes don't fit in the cache, but are still served.
+		res := get(hfs, hashPath, "gzip")
+		if got := res.Header.Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("bad content-encoding; \ngot:  %s, \nwant: %s", got, "gzip")
+			return
+		}
+		if b, exists := hfs.compressCache[hashPath]; !exists || b != nil {
+			t.Fatal("file should have been marked as not fitting in the cache")
+			return
+		}
+
+		//The file is not compressed again on later requests.
+		for i := 0; i < 2; i++ {
+			res := get(hfs, hashPath, "gzip")
+			if got := res.Header.Get("Content-Encoding"); got != "" {
+				t.Fatalf("bad content-encoding; \ngot:  %s, \nwant: %s", got, "")
+				return
+			}
+
+			body, _ := io.ReadAll(res.Body)
+			if string(body) != css {
+				t.Fatal("bad content")
+				return
+			}
+		}
+		if hfs.compressCacheUsed != 0 {
+			t.Fatal("compressed bytes should not have been cached")
+			return
+		}
+	})
+
+	t.Run("Vary", func(t *testing.T) {
+		hfs := NewFS(mfs, Compress(0))
+
+		//Both the precompressed sibling and on-the-fly compression are considered.
+		res := get(hfs, hfs.GetHashPath("precomp.js"), "identity")
+		if got := res.Header.Values("Vary"); len(got) != 1 || got[0] != "Accept-Encoding" {
+			t.Fatalf("bad vary; \ngot:  %v, \nwant: %s", got, "Accept-Encoding")
+			return
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package hashfs
+
+import (
+	"net/http"
+	"strings"
+)
+
+// entityTag returns the value for the ETag header for a file with the given hash
+// that is served with the given Content-Encoding, if any. The value is quoted, as
+// required by RFC 9110, so that http.ServeContent can evaluate conditional requests.
+//
+// The encoding is included since the bytes served differ per-encoding and an entity
+// tag must be unique per representation.
+func entityTag(hash, encoding string) string {
+	if encoding != "" {
+		return `"` + hash + "-" + encoding + `"`
+	}
+
+	return `"` + hash + `"`
+}
+
+// checkPreconditions evaluates the If-Match and If-None-Match headers of a request
+// against the ETag header already set on w, per RFC 9110 section 13.2.2. This is
+// used for files that can't be served with http.ServeContent, which evaluates these
+// headers itself.
+//
+// True is returned if a 304 Not Modified or 412 Precondition Failed response was
+// written and nothing else should be written.
+func checkPreconditions(w http.ResponseWriter, r *http.Request) (done bool) {
+	etag := w.Header().Get("ETag")
+
+	//If-Match uses the strong comparison function, so weak entity tags never match.
+	if im := r.Header.Get("If-Match"); im != "" && !etagListMatches(im, etag, false) {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return true
+	}
+
+	//If-None-Match uses the weak comparison function, so the W/ prefix added by
+	//some proxies, i.e. Cloudflare, doesn't prevent 304 responses.
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagListMatches(inm, etag, true) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return true
+		}
+
+		//Headers that describe the content are removed since no content is sent.
+		//The ETag, Cache-Control, and Vary headers are kept, as required.
+		h := w.Header()
+		delete(h, "Content-Type")
+		delete(h, "Content-Length")
+		delete(h, "Content-Encoding")
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+
+	return false
+}
+
+// etagListMatches returns true if the list of entity tags from an If-Match or
+// If-None-Match header includes etag. A "*" matches any etag. If weak is true, the
+// weak comparison function is used which ignores the W/ prefix. Otherwise, the
+// strong comparison function is used and weak entity tags never match.
+func etagListMatches(list, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	} else if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		} else if strings.HasPrefix(candidate, "W/") {
+			continue
+		}
+
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,166 @@
+package hashfs
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+// noSeekFS wraps an fs.FS so that files cannot be seeked, to test serving files
+// without http.ServeContent.
+type noSeekFS struct {
+	fs.FS
+}
+
+type noSeekFile struct {
+	fs.File
+}
+
+func (n noSeekFS) Open(name string) (fs.File, error) {
+	f, err := n.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return noSeekFile{f}, nil
+}
+
+func TestEtagListMatches(t *testing.T) {
+	tests := []struct {
+		list  string
+		etag  string
+		weak  bool
+		match bool
+	}{
+		{`"abc"`, `"abc"`, false, true},
+		{`"abc"`, `"abc"`, true, true},
+		{`"xyz", "abc"`, `"abc"`, false, true},
+		{`"xyz"`, `"abc"`, true, false},
+		{`*`, `"abc"`, false, true},
+		{`*`, ``, false, false},
+		{`W/"abc"`, `"abc"`, true, true},
+		{`W/"abc"`, `"abc"`, false, false},
+		{`"abc"`, `W/"abc"`, false, false},
+		{`abc`, `"abc"`, true, false},
+	}
+
+	for _, tt := range tests {
+		got := etagListMatches(tt.list, tt.etag, tt.weak)
+		if got != tt.match {
+			t.Fatalf("bad match for %s against %s (weak: %t); \ngot:  %t, \nwant: %t", tt.list, tt.etag, tt.weak, got, tt.match)
+			return
+		}
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	mfs := fstest.MapFS{
+		"js/app.js": {Data: []byte("console.log('app');")},
+	}
+
+	for _, fsys := range []fs.FS{mfs, noSeekFS{mfs}} {
+		name := "Seekable"
+		if _, ok := fsys.(noSeekFS); ok {
+			name = "NotSeekable"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			hfs := NewFS(fsys)
+			hashPath := hfs.GetHashPath("js/app.js")
+			etag := entityTag(hfs.hashPathReverse[hashPath].hash, "")
+
+			get := func(method string, headers map[string]string) *http.Response {
+				r := httptest.NewRequest(method, "/"+hashPath, nil)
+				for k, v := range headers {
+					r.Header.Set(k, v)
+				}
+				w := httptest.NewRecorder()
+				FileServer(hfs).ServeHTTP(w, r)
+				return w.Result()
+			}
+
+			t.Run("ETag", func(t *testing.T) {
+				res := get("GET", nil)
+				if res.StatusCode != http.StatusOK {
+					t.Fatal("bad code", res.StatusCode)
+					return
+				}
+				if got := res.Header.Get("ETag"); got != etag {
+					t.Fatalf("bad etag; \ngot:  %s, \nwant: %s", got, etag)
+					return
+				}
+			})
+
+			t.Run("IfNoneMatch", func(t *testing.T) {
+				for _, inm := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+					res := get("GET", map[string]string{"If-None-Match": inm})
+					if res.StatusCode != http.StatusNotModified {
+						t.Fatalf("bad code for %s; \ngot:  %d, \nwant: %d", inm, res.StatusCode, http.StatusNotModified)
+						return
+					}
+					if got := res.Header.Get("ETag"); got != etag {
+						t.Fatalf("bad etag; \ngot:  %s, \nwant: %s", got, etag)
+						return
+					}
+					if got := res.Header.Get("Cache-Control"); got != hfs.getCacheControl() {
+						t.Fatalf("bad cache-control; \ngot:  %s, \nwant: %s", got, hfs.getCacheControl())
+						return
+					}
+					if body, _ := io.ReadAll(res.Body); len(body) != 0 {
+						t.Fatal("expected no body", string(body))
+						return
+					}
+				}
+
+				res := get("GET", map[string]string{"If-None-Match": `"other"`})
+				if res.StatusCode != http.StatusOK {
+					t.Fatal("bad code", res.StatusCode)
+					return
+				}
+			})
+
+			t.Run("IfMatch", func(t *testing.T) {
+				res := get("GET", map[string]string{"If-Match": etag})
+				if res.StatusCode != http.StatusOK {
+					t.Fatal("bad code", res.StatusCode)
+					return
+				}
+
+				res = get("GET", map[string]string{"If-Match": `"other"`})
+				if res.StatusCode != http.StatusPreconditionFailed {
+					t.Fatal("bad code", res.StatusCode)
+					return
+				}
+			})
+
+			t.Run("IfRange", func(t *testing.T) {
+				//Ranges are only supported for seekable files.
+				want := http.StatusPartialContent
+				if name == "NotSeekable" {
+					want = http.StatusOK
+				}
+
+				res := get("GET", map[string]string{"Range": "bytes=0-6", "If-Range": etag})
+				if res.StatusCode != want {
+					t.Fatalf("bad code; \ngot:  %d, \nwant: %d", res.StatusCode, want)
+					return
+				}
+
+				//A stale If-Range means the full file is served.
+				res = get("GET", map[string]string{"Range": "bytes=0-6", "If-Range": `"other"`})
+				if res.StatusCode != http.StatusOK {
+					t.Fatal("bad code", res.StatusCode)
+					return
+				}
+				body, _ := io.ReadAll(res.Body)
+				if string(body) != "console.log('app');" {
+					t.Fatalf("bad content; \ngot:  %s, \nwant: %s", body, "console.log('app');")
+					return
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package hashfs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// HashLocationDirectory sets the hash to be added as a leading directory, leaving
+// the file's path intact. css/styles.css becomes a1b2c3...d4e5f6/css/styles.css.
+//
+// This is helpful for files whose names must not change, i.e. files loaded by
+// third-party code that expects a specific filename. Each file has its own hash, so
+// relative references between files, i.e. a Web Worker loading a sibling file, will
+// not resolve. Use HashLocationTree for that.
+func HashLocationDirectory() optionFunc {
+	return func(hfs *HFS) {
+		hfs.hashLocation = hashLocationDirectory
+	}
+}
+
+// HashLocationTree sets a single hash, calculated from every file in the fs.FS, to
+// be added as a leading directory for every file, leaving each file's path intact.
+// css/styles.css becomes a1b2c3...d4e5f6/css/styles.css and fonts/icons.woff2
+// becomes a1b2c3...d4e5f6/fonts/icons.woff2.
+//
+// Since every file shares the same leading directory, relative references between
+// files still resolve, i.e. fonts referenced by third-party CSS, Web Workers, or WASM
+// files loading sibling files. The downside is that a change to any file changes the
+// hash path of every file, so browsers will download every file again after each
+// release.
+//
+// The tree hash is calculated the first time a hash path is needed, which requires
+// reading every file in the fs.FS. The ETag for each file is still based on the
+// file's own contents.
+func HashLocationTree() optionFunc {
+	return func(hfs *HFS) {
+		hfs.hashLocation = hashLocationTree
+	}
+}
+
+// pathHash returns the hash used in the hash path for a file with the given hash.
+// This is the file's hash except when HashLocationTree is used.
+func (hfs *HFS) pathHash(hash string) (string, error) {
+	if hfs.hashLocation != hashLocationTree || hfs.filenamePattern != nil {
+		return hash, nil
+	}
+
+	return hfs.treeHash()
+}
+
+// treeHash returns the hash of every file in the fs.FS, calculating it if needed.
+func (hfs *HFS) treeHash() (string, error) {
+	hfs.treeMu.Lock()
+	defer hfs.treeMu.Unlock()
+
+	if hfs.tree != "" {
+		return hfs.tree, nil
+	}
+
+	tree, err := hfs.calculateTreeHash()
+	if err != nil {
+		return "", err
+	}
+
+	hfs.tree = tree
+	return tree, nil
+}
+
+// calculateTreeHash calculates a hash from the path and hash of every file in the
+// fs.FS. The files' original, not rewritten, contents are used since rewritten
+// contents include hash paths which include the tree hash.
+func (hfs *HFS) calculateTreeHash() (string, error) {
+	var b strings.Builder
+	err := fs.WalkDir(hfs.fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		fileContents, err := fs.ReadFile(hfs.fsys, p)
+		if err != nil {
+			return err
+		}
+
+		//WalkDir walks in lexical order, so the result is the same every time.
+		b.WriteString(p)
+		b.WriteByte(0)
+		b.WriteString(hfs.calculateHash(fileContents))
+		b.WriteByte('\n')
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s", ErrNotExist, err)
+	} else if err != nil {
+		return "", err
+	}
+
+	return hfs.calculateHash([]byte(b.String())), nil
+}
+
+// hashPathDir returns the directory a file's hash path will be in. This is used to
+// build references relative to the hash path, which may be in a different directory
+// than the original path, before the file's hash is known.
+//
+// When the hash is part of the directory, a placeholder that won't match any real
+// hash is used. The resulting relative references are longer than needed, climbing
+// up past the hash and back down, but still resolve correctly.
+func (hfs *HFS) hashPathDir(originalPath string) string {
+	if hfs.hashLocation == hashLocationTree && hfs.filenamePattern == nil {
+		if tree, err := hfs.treeHash(); err == nil {
+			return path.Dir(hfs.buildHashPath(originalPath, tree))
+		}
+	}
+
+	return path.Dir(hfs.buildHashPath(originalPath, "\x00"))
+}
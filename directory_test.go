@@ -0,0 +1,155 @@
+package hashfs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestHashLocationDirectory(t *testing.T) {
+	originalPath := "testdata/subdir1/script.js"
+
+	t.Run("HashPath", func(t *testing.T) {
+		hfs := NewFS(fsys, HashLocationDirectory())
+		got := hfs.GetHashPath(originalPath)
+		want := scriptjs + "/" + originalPath
+		if got != want {
+			t.Fatalf("bad hash path; \ngot:  %s, \nwant: %s", got, want)
+			return
+		}
+	})
+
+	t.Run("FileServer", func(t *testing.T) {
+		hashPath := NewFS(fsys, HashLocationDirectory()).GetHashPath(originalPath)
+
+		//A new HFS, i.e. another replica, must be able to serve the hash path.
+		hfs := NewFS(fsys, HashLocationDirectory())
+		r := httptest.NewRequest("GET", "/"+hashPath, nil)
+		w := httptest.NewRecorder()
+		FileServer(hfs).ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatal("bad code", w.Code)
+			return
+		}
+		if got := w.Header().Get("Cache-Control"); got != hfs.getCacheControl() {
+			t.Fatalf("bad cache-control; \ngot:  %s, \nwant: %s", got, hfs.getCacheControl())
+			return
+		}
+		if got := w.Header().Get("ETag"); got != entityTag(scriptjs, "") {
+			t.Fatalf("bad etag; \ngot:  %s, \nwant: %s", got, entityTag(scriptjs, ""))
+			return
+		}
+
+		//Another file's hash must not be served.
+		r = httptest.NewRequest("GET", "/"+stylesmincss+"/"+originalPath, nil)
+		w = httptest.NewRecorder()
+		FileServer(hfs).ServeHTTP(w, r)
+		if w.Code != http.StatusNotFound {
+			t.Fatal("bad code", w.Code)
+			return
+		}
+	})
+
+	t.Run("Rewrite", func(t *testing.T) {
+		mfs := fstest.MapFS{
+			"css/styles.css": {Data: []byte(`@font-face { src: url(../fonts/x.woff2); }`)},
+			"fonts/x.woff2":  {Data: []byte("woff2")},
+		}
+		hfs := NewFS(mfs, HashLocationDirectory(), RewriteCSS())
+
+		cssHashPath := hfs.GetHashPath("css/styles.css")
+		fontHashPath := hfs.GetHashPath("fonts/x.woff2")
+
+		//The rewritten reference must resolve, from the CSS file's hash path, to
+		//the font's hash path.
+		content := string(hfs.hashPathReverse[cssHashPath].content)
+		ref := regexp.MustCompile(`url\(([^)]+)\)`).FindStringSubmatch(content)[1]
+		if got := path.Join(path.Dir(cssHashPath), ref); got != fontHashPath {
+			t.Fatalf("bad resolved reference; \ngot:  %s, \nwant: %s", got, fontHashPath)
+			return
+		}
+	})
+}
+
+func TestHashLocationTree(t *testing.T) {
+	mfs := fstest.MapFS{
+		"js/app.js":      {Data: []byte(`new Worker("worker.js");`)},
+		"js/worker.js":   {Data: []byte(`console.log("worker");`)},
+		"css/styles.css": {Data: []byte(`@font-face { src: url(../fonts/x.woff2); }`)},
+		"fonts/x.woff2":  {Data: []byte("woff2")},
+	}
+
+	t.Run("HashPath", func(t *testing.T) {
+		hfs := NewFS(mfs, HashLocationTree())
+		appHashPath := hfs.GetHashPath("js/app.js")
+		workerHashPath := hfs.GetHashPath("js/worker.js")
+
+		tree, _, _ := strings.Cut(appHashPath, "/")
+		if appHashPath != tree+"/js/app.js" || workerHashPath != tree+"/js/worker.js" {
+			t.Fatal("every file should share the tree hash", appHashPath, workerHashPath)
+			return
+		}
+
+		//Changing any file changes the tree hash.
+		changed := fstest.MapFS{}
+		for p, f := range mfs {
+			changed[p] = f
+		}
+		changed["fonts/x.woff2"] = &fstest.MapFile{Data: []byte("woff2 v2")}
+		if NewFS(changed, HashLocationTree()).GetHashPath("js/app.js") == appHashPath {
+			t.Fatal("tree hash should change when any file changes")
+			return
+		}
+	})
+
+	t.Run("Sibling", func(t *testing.T) {
+		appHashPath := NewFS(mfs, HashLocationTree()).GetHashPath("js/app.js")
+
+		//The browser resolves worker.js relative to app.js's hash path. A new HFS,
+		//i.e. another replica, must be able to serve it.
+		hfs := NewFS(mfs, HashLocationTree())
+		r := httptest.NewRequest("GET", "/"+path.Join(path.Dir(appHashPath), "worker.js"), nil)
+		w := httptest.NewRecorder()
+		FileServer(hfs).ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatal("bad code", w.Code)
+			return
+		}
+		if got := w.Header().Get("Cache-Control"); got != hfs.getCacheControl() {
+			t.Fatalf("bad cache-control; \ngot:  %s, \nwant: %s", got, hfs.getCacheControl())
+			return
+		}
+		if got, want := w.Header().Get("ETag"), entityTag(hfs.calculateHash([]byte(`console.log("worker");`)), ""); got != want {
+			t.Fatalf("bad etag; \ngot:  %s, \nwant: %s", got, want)
+			return
+		}
+	})
+
+	t.Run("Rewrite", func(t *testing.T) {
+		hfs := NewFS(mfs, HashLocationTree(), RewriteCSS())
+		cssHashPath := hfs.GetHashPath("css/styles.css")
+
+		content := string(hfs.hashPathReverse[cssHashPath].content)
+		want := `@font-face { src: url(../fonts/x.woff2); }`
+		if content != want {
+			t.Fatalf("bad rewritten content; \ngot:  %s, \nwant: %s", content, want)
+			return
+		}
+	})
+
+	t.Run("Invalidate", func(t *testing.T) {
+		hfs := NewFS(mfs, HashLocationTree())
+		hfs.GetHashPath("js/app.js")
+		hfs.GetHashPath("js/worker.js")
+
+		hfs.Invalidate("js/app.js")
+		if len(hfs.hashPathReverse) != 0 || hfs.tree != "" {
+			t.Fatal("every file should be invalidated")
+			return
+		}
+	})
+}
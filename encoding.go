@@ -0,0 +1,158 @@
+package hashfs
+
+import (
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// precompressedEncodings are the Content-Encodings supported for precompressed
+// sibling files along with the file extension of each sibling. For example, a
+// precompressed brotli version of script.js would be stored as script.js.br.
+//
+// The order of this list is used as the preference when the browser accepts more
+// than one encoding with the same q-value.
+var precompressedEncodings = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"zstd", ".zst"},
+	{"gzip", ".gz"},
+}
+
+// openPrecompressed looks for precompressed sibling files of the file at the
+// originalPath and, if one exists in an encoding the browser accepts, returns the
+// opened precompressed file, its info, and its encoding. The Content-Encoding,
+// Content-Type, and Vary headers are set as needed.
+//
+// A nil file is returned if no precompressed sibling should be served, in which case
+// the original file should be served as usual.
+func (hfs *HFS) openPrecompressed(w http.ResponseWriter, r *http.Request, originalPath string) (f fs.File, info fs.FileInfo, encoding string) {
+	//Find which siblings exist.
+	var available []string
+	for _, pe := range precompressedEncodings {
+		if _, err := fs.Stat(hfs.fsys, originalPath+pe.ext); err == nil {
+			available = append(available, pe.encoding)
+		}
+	}
+	if len(available) == 0 {
+		return
+	}
+
+	//The response now depends on the Accept-Encoding header, regardless of whether
+	//or not a precompressed sibling is served, so caches need to know this.
+	addVaryAcceptEncoding(w)
+
+	encoding = negotiateEncoding(r.Header.Get("Accept-Encoding"), available)
+	if encoding == "" {
+		return
+	}
+
+	//Open the sibling.
+	//
+	//On error, just serve the original file since it is always acceptable.
+	var ext string
+	for _, pe := range precompressedEncodings {
+		if pe.encoding == encoding {
+			ext = pe.ext
+		}
+	}
+
+	f, err := hfs.fsys.Open(originalPath + ext)
+	if err != nil {
+		return nil, nil, ""
+	}
+
+	info, err = f.Stat()
+	if err != nil || info.IsDir() {
+		f.Close()
+		return nil, nil, ""
+	}
+
+	setEncodingHeaders(w, originalPath, encoding)
+	return
+}
+
+// setEncodingHeaders sets the Content-Encoding and Content-Type headers for a
+// response that is serving encoded (compressed) bytes.
+//
+// The Content-Type must be based on the original file's extension, otherwise
+// http.ServeContent would sniff the compressed bytes.
+func setEncodingHeaders(w http.ResponseWriter, originalPath, encoding string) {
+	contentType := mime.TypeByExtension(path.Ext(originalPath))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Encoding", encoding)
+}
+
+// addVaryAcceptEncoding adds Accept-Encoding to the Vary header, unless it was
+// already added, i.e. when a file without a precompressed sibling is then compressed
+// on-the-fly.
+func addVaryAcceptEncoding(w http.ResponseWriter) {
+	for _, v := range w.Header().Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), "Accept-Encoding") {
+				return
+			}
+		}
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+}
+
+// negotiateEncoding returns the best encoding from the available encodings based on
+// the q-values in the Accept-Encoding header. A blank encoding is returned if none
+// of the available encodings are acceptable, meaning the unencoded file should be
+// served.
+//
+// Encodings not listed in the header are not acceptable unless a "*" is listed. When
+// more than one encoding has the same q-value, the order of available is used.
+func negotiateEncoding(acceptEncoding string, available []string) (encoding string) {
+	//Parse the header into each encoding and its q-value.
+	qValues := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+			if !found || strings.ToLower(strings.TrimSpace(key)) != "q" {
+				continue
+			}
+
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err == nil {
+				q = parsed
+			}
+		}
+
+		qValues[name] = q
+	}
+
+	//Find the best available encoding. Only encodings with a q-value greater than
+	//0 are acceptable.
+	best := 0.0
+	for _, a := range available {
+		q, listed := qValues[a]
+		if !listed {
+			q = qValues["*"]
+		}
+
+		if q > best {
+			best = q
+			encoding = a
+		}
+	}
+
+	return
+}
@@ -0,0 +1,129 @@
+package hashfs
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	available := []string{"br", "zstd", "gzip"}
+
+	tests := []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip, br", "br"},
+		{"gzip, deflate, br, zstd", "br"},
+		{"br;q=0.5, gzip", "gzip"},
+		{"br;q=0, gzip;q=0.1", "gzip"},
+		{"br;q=0", ""},
+		{"*", "br"},
+		{"*;q=0.5, gzip", "gzip"},
+		{"identity", ""},
+		{"GZIP ; q=0.8", "gzip"},
+	}
+
+	for _, tt := range tests {
+		got := negotiateEncoding(tt.acceptEncoding, available)
+		if got != tt.want {
+			t.Fatalf("bad encoding for %q; \ngot:  %s, \nwant: %s", tt.acceptEncoding, got, tt.want)
+			return
+		}
+	}
+}
+
+func TestPrecompressed(t *testing.T) {
+	mfs := fstest.MapFS{
+		"app.js":    {Data: []byte("console.log('app');")},
+		"app.js.br": {Data: []byte("brotli")},
+		"app.js.gz": {Data: []byte("gzip")},
+		"plain.js":  {Data: []byte("console.log('plain');")},
+	}
+	hfs := NewFS(mfs)
+	hashPath := hfs.GetHashPath("app.js")
+	hash := hfs.hashPathReverse[hashPath].hash
+
+	get := func(p, acceptEncoding string) *http.Response {
+		r := httptest.NewRequest("GET", "/"+p, nil)
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+		w := httptest.NewRecorder()
+		FileServer(hfs).ServeHTTP(w, r)
+		return w.Result()
+	}
+
+	t.Run("Brotli", func(t *testing.T) {
+		res := get(hashPath, "gzip, br")
+		body, _ := io.ReadAll(res.Body)
+		if string(body) != "brotli" {
+			t.Fatalf("bad content; \ngot:  %s, \nwant: %s", body, "brotli")
+			return
+		}
+		if got := res.Header.Get("Content-Encoding"); got != "br" {
+			t.Fatalf("bad content-encoding; \ngot:  %s, \nwant: %s", got, "br")
+			return
+		}
+		if got := res.Header.Get("Content-Type"); got != "text/javascript; charset=utf-8" {
+			t.Fatalf("bad content-type; \ngot:  %s, \nwant: %s", got, "text/javascript; charset=utf-8")
+			return
+		}
+		if got := res.Header.Get("Vary"); got != "Accept-Encoding" {
+			t.Fatalf("bad vary; \ngot:  %s, \nwant: %s", got, "Accept-Encoding")
+			return
+		}
+		if got := res.Header.Get("ETag"); got != `"`+hash+`-br"` {
+			t.Fatalf("bad etag; \ngot:  %s, \nwant: %s", got, `"`+hash+`-br"`)
+			return
+		}
+	})
+
+	t.Run("Gzip", func(t *testing.T) {
+		res := get(hashPath, "gzip")
+		body, _ := io.ReadAll(res.Body)
+		if string(body) != "gzip" {
+			t.Fatalf("bad content; \ngot:  %s, \nwant: %s", body, "gzip")
+			return
+		}
+		if got := res.Header.Get("ETag"); got != `"`+hash+`-gzip"` {
+			t.Fatalf("bad etag; \ngot:  %s, \nwant: %s", got, `"`+hash+`-gzip"`)
+			return
+		}
+	})
+
+	t.Run("Identity", func(t *testing.T) {
+		res := get(hashPath, "")
+		body, _ := io.ReadAll(res.Body)
+		if string(body) != "console.log('app');" {
+			t.Fatalf("bad content; \ngot:  %s, \nwant: %s", body, "console.log('app');")
+			return
+		}
+		if got := res.Header.Get("Content-Encoding"); got != "" {
+			t.Fatalf("bad content-encoding; \ngot:  %s, \nwant: %s", got, "")
+			return
+		}
+		if got := res.Header.Get("Vary"); got != "Accept-Encoding" {
+			t.Fatalf("bad vary; \ngot:  %s, \nwant: %s", got, "Accept-Encoding")
+			return
+		}
+		if got := res.Header.Get("ETag"); got != `"`+hash+`"` {
+			t.Fatalf("bad etag; \ngot:  %s, \nwant: %s", got, `"`+hash+`"`)
+			return
+		}
+	})
+
+	t.Run("NoSiblings", func(t *testing.T) {
+		res := get(hfs.GetHashPath("plain.js"), "gzip, br")
+		if got := res.Header.Get("Content-Encoding"); got != "" {
+			t.Fatalf("bad content-encoding; \ngot:  %s, \nwant: %s", got, "")
+			return
+		}
+		if got := res.Header.Get("Vary"); got != "" {
+			t.Fatalf("bad vary; \ngot:  %s, \nwant: %s", got, "")
+			return
+		}
+	})
+}
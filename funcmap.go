@@ -0,0 +1,150 @@
+package hashfs
+
+import (
+	"html/template"
+	"strings"
+)
+
+// FuncMapOptions are the options used to build the funcs returned by FuncMap.
+type FuncMapOptions struct {
+	//Prefix is the URL path your static files are served from, i.e. "/static/".
+	//This is removed from the URLs given to each func before looking up the file
+	//in the fs.FS and is added back to the hash path. URLs that do not start with
+	//the prefix are looked up as-is. The prefix is normalized to start and end
+	//with a slash. Default is the URLPrefix option provided to NewFS, if any.
+	Prefix string
+
+	//CrossOrigin is the value of the crossorigin attribute added to tags. Default
+	//is "anonymous", which is required for Subresource Integrity checks on files
+	//served from another origin, such as a CDN.
+	CrossOrigin string
+}
+
+// FuncMap returns an html/template.FuncMap with funcs for using hashfs in your HTML
+// templates. This saves you from having to write your own "static" func.
+//
+//   - static: returns the hash path URL, i.e. {{static "/static/css/styles.css"}}.
+//   - integrity: returns the Subresource Integrity value, i.e.
+//     {{integrity "/static/css/styles.css"}}.
+//   - scriptTag: returns a <script> tag with src, integrity, and crossorigin
+//     attributes, i.e. {{scriptTag "/static/js/script.js" "defer"}}.
+//   - stylesheetTag: returns a <link rel="stylesheet"> tag with href, integrity,
+//     and crossorigin attributes, i.e. {{stylesheetTag "/static/css/styles.css"}}.
+//   - preloadTag: returns a <link rel="preload"> tag with href, as, integrity, and
+//     crossorigin attributes, i.e. {{preloadTag "/static/fonts/x.woff2" "font"}}.
+//
+// Additional attributes can be provided to scriptTag and stylesheetTag as "name" or
+// "name=value", i.e. {{scriptTag "/static/js/script.js" "type=module"}}.
+//
+// Each func returns an error, causing the template to fail to execute, if a file
+// cannot be hashed. This way typos in paths are caught rather than silently serving
+// a non-cache-busted URL.
+func (hfs *HFS) FuncMap(opts FuncMapOptions) template.FuncMap {
+	if opts.Prefix == "" {
+		opts.Prefix = hfs.urlPrefix
+	} else {
+		opts.Prefix = normalizePrefix(opts.Prefix)
+	}
+	if opts.CrossOrigin == "" {
+		opts.CrossOrigin = "anonymous"
+	}
+
+	fm := funcMap{hfs, opts}
+	return template.FuncMap{
+		"static":        fm.static,
+		"integrity":     fm.integrity,
+		"scriptTag":     fm.scriptTag,
+		"stylesheetTag": fm.stylesheetTag,
+		"preloadTag":    fm.preloadTag,
+	}
+}
+
+// funcMap implements the funcs returned by FuncMap.
+type funcMap struct {
+	hfs  *HFS
+	opts FuncMapOptions
+}
+
+// originalPath returns the path to the file in the fs.FS for a URL.
+func (fm funcMap) originalPath(url string) string {
+	if trimmed, found := strings.CutPrefix(url, fm.opts.Prefix); found && fm.opts.Prefix != "" {
+		return trimmed
+	}
+
+	return strings.TrimPrefix(url, "/")
+}
+
+// static returns the hash path URL for a URL.
+func (fm funcMap) static(url string) (string, error) {
+	hashPath, err := fm.hfs.getHashPath(fm.originalPath(url), nil)
+	if err != nil {
+		return "", err
+	}
+
+	prefix := fm.opts.Prefix
+	if prefix == "" {
+		prefix = "/"
+	}
+	return strings.TrimSuffix(prefix, "/") + "/" + hashPath, nil
+}
+
+// integrity returns the Subresource Integrity value for a URL.
+func (fm funcMap) integrity(url string) (string, error) {
+	//Make sure the file can be hashed so that an error is returned if not.
+	originalPath := fm.originalPath(url)
+	_, err := fm.hfs.getHashPath(originalPath, nil)
+	if err != nil {
+		return "", err
+	}
+
+	return fm.hfs.integrity(originalPath), nil
+}
+
+// tag builds an HTML tag with the URL attribute, named by urlAttr, set to the hash
+// path of url along with integrity, crossorigin, and any additional attributes.
+func (fm funcMap) tag(name, urlAttr, url string, attrs []string) (template.HTML, error) {
+	hashURL, err := fm.static(url)
+	if err != nil {
+		return "", err
+	}
+	integrity, err := fm.integrity(url)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("<" + name)
+	for _, attr := range attrs {
+		attrName, value, hasValue := strings.Cut(attr, "=")
+		b.WriteString(" " + template.HTMLEscapeString(attrName))
+		if hasValue {
+			b.WriteString(`="` + template.HTMLEscapeString(value) + `"`)
+		}
+	}
+	b.WriteString(" " + urlAttr + `="` + template.HTMLEscapeString(hashURL) + `"`)
+	b.WriteString(` integrity="` + template.HTMLEscapeString(integrity) + `"`)
+	b.WriteString(` crossorigin="` + template.HTMLEscapeString(fm.opts.CrossOrigin) + `">`)
+
+	return template.HTML(b.String()), nil
+}
+
+// scriptTag returns a <script> tag for a URL.
+func (fm funcMap) scriptTag(url string, attrs ...string) (template.HTML, error) {
+	tag, err := fm.tag("script", "src", url, attrs)
+	if err != nil {
+		return "", err
+	}
+
+	return tag + "</script>", nil
+}
+
+// stylesheetTag returns a <link rel="stylesheet"> tag for a URL.
+func (fm funcMap) stylesheetTag(url string, attrs ...string) (template.HTML, error) {
+	return fm.tag("link", "href", url, append([]string{"rel=stylesheet"}, attrs...))
+}
+
+// preloadTag returns a <link rel="preload"> tag for a URL. The as argument is the
+// type of content being preloaded, i.e. script, style, or font.
+func (fm funcMap) preloadTag(url, as string) (template.HTML, error) {
+	return fm.tag("link", "href", url, []string{"rel=preload", "as=" + as})
+}
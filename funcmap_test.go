@@ -0,0 +1,121 @@
+package hashfs
+
+import (
+	"errors"
+	"html/template"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestFuncMap(t *testing.T) {
+	hfs := NewFS(fsys)
+	fm := hfs.FuncMap(FuncMapOptions{Prefix: "/static/"})
+
+	hashURL := "/static/testdata/subdir1/script.js-" + scriptjs + ".js"
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{
+			"Static",
+			`{{static "/static/testdata/subdir1/script.js"}}`,
+			hashURL,
+		},
+		{
+			"StaticWithoutPrefix",
+			`{{static "testdata/subdir1/script.js"}}`,
+			hashURL,
+		},
+		{
+			"Integrity",
+			`{{integrity "/static/testdata/subdir1/script.js"}}`,
+			strings.ReplaceAll(scriptjsSHA384Integrity, "+", "&#43;"), //html/template escapes +.
+		},
+		{
+			"ScriptTag",
+			`{{scriptTag "/static/testdata/subdir1/script.js" "defer" "type=module"}}`,
+			`<script defer type="module" src="` + hashURL + `" integrity="` + scriptjsSHA384Integrity + `" crossorigin="anonymous"></script>`,
+		},
+		{
+			"StylesheetTag",
+			`{{stylesheetTag "/static/testdata/subdir1/styles.min.css"}}`,
+			`<link rel="stylesheet" href="/static/testdata/subdir1/styles.min.css-` + stylesmincss + `.css" integrity="` + hfs.Integrity("testdata/subdir1/styles.min.css") + `" crossorigin="anonymous">`,
+		},
+		{
+			"PreloadTag",
+			`{{preloadTag "/static/testdata/subdir1/script.js" "script"}}`,
+			`<link rel="preload" as="script" href="` + hashURL + `" integrity="` + scriptjsSHA384Integrity + `" crossorigin="anonymous">`,
+		},
+		{
+			"EscapedAttribute",
+			`{{scriptTag "/static/testdata/subdir1/script.js" "data-x=\"><script>"}}`,
+			`<script data-x="&#34;&gt;&lt;script&gt;" src="` + hashURL + `" integrity="` + scriptjsSHA384Integrity + `" crossorigin="anonymous"></script>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := template.Must(template.New("").Funcs(fm).Parse(tt.template))
+
+			var b strings.Builder
+			err := tmpl.Execute(&b, nil)
+			if err != nil {
+				t.Fatal(err)
+				return
+			}
+			if b.String() != tt.want {
+				t.Fatalf("bad output; \ngot:  %s, \nwant: %s", b.String(), tt.want)
+				return
+			}
+		})
+	}
+
+	t.Run("CrossOrigin", func(t *testing.T) {
+		fm := hfs.FuncMap(FuncMapOptions{Prefix: "/static/", CrossOrigin: "use-credentials"})
+		tmpl := template.Must(template.New("").Funcs(fm).Parse(`{{stylesheetTag "/static/testdata/subdir1/styles.min.css"}}`))
+
+		var b strings.Builder
+		err := tmpl.Execute(&b, nil)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if !strings.Contains(b.String(), `crossorigin="use-credentials"`) {
+			t.Fatal("crossorigin not set", b.String())
+			return
+		}
+	})
+
+	t.Run("PrefixNormalized", func(t *testing.T) {
+		for _, prefix := range []string{"/static", "static/", "static"} {
+			fm := hfs.FuncMap(FuncMapOptions{Prefix: prefix})
+			tmpl := template.Must(template.New("").Funcs(fm).Parse(`{{static "/static/testdata/subdir1/script.js"}}`))
+
+			var b strings.Builder
+			err := tmpl.Execute(&b, nil)
+			if err != nil {
+				t.Fatal(prefix, err)
+				return
+			}
+			if b.String() != hashURL {
+				t.Fatalf("bad output for %s; \ngot:  %s, \nwant: %s", prefix, b.String(), hashURL)
+				return
+			}
+		}
+	})
+
+	t.Run("NotExist", func(t *testing.T) {
+		for _, name := range []string{"static", "integrity", "scriptTag", "stylesheetTag"} {
+			tmpl := template.Must(template.New("").Funcs(fm).Parse(`{{` + name + ` "/static/missing.js"}}`))
+
+			err := tmpl.Execute(io.Discard, nil)
+			if !errors.Is(err, ErrNotExist) {
+				t.Fatalf("expected ErrNotExist for %s; got %v", name, err)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package hashfs
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+	"strings"
+)
+
+// Encoding is how a hash is encoded for use in hash paths.
+type Encoding int
+
+const (
+	EncodingHex       Encoding = iota //lowercase hexadecimal, the default
+	EncodingBase32                    //lowercase base32, unpadded
+	EncodingBase36                    //0-9 and lowercase a-z
+	EncodingBase62                    //0-9, lowercase a-z, and uppercase A-Z
+	EncodingBase64URL                 //URL safe base64, unpadded; may include - and _
+)
+
+// base32Lower is base32 with a lowercase alphabet, since hex is lowercase and most
+// URLs are too, and without padding since = doesn't belong in a filename.
+var base32Lower = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// HashEncoding sets how the hash is encoded in hash paths. Default is EncodingHex.
+// Encodings with larger alphabets produce shorter hashes for the same hash, i.e. a
+// SHA256 hash is 64 characters in hex but 43 characters in base62.
+//
+// When used with HashLength, the hash is trimmed to the given number of characters
+// of the chosen encoding. This will panic if an unsupported encoding is provided.
+func HashEncoding(e Encoding) optionFunc {
+	return func(hfs *HFS) {
+		switch e {
+		case EncodingHex, EncodingBase32, EncodingBase36, EncodingBase62, EncodingBase64URL:
+			hfs.hashEncoding = e
+		default:
+			panic("unsupported hash encoding used")
+		}
+	}
+}
+
+// encode encodes a hash. Every hash of the same length is encoded to the same
+// number of characters so that hash paths can be parsed.
+func (e Encoding) encode(hash []byte) string {
+	switch e {
+	case EncodingBase32:
+		return base32Lower.EncodeToString(hash)
+	case EncodingBase36:
+		return encodeBase(hash, 36)
+	case EncodingBase62:
+		return encodeBase(hash, 62)
+	case EncodingBase64URL:
+		return base64.RawURLEncoding.EncodeToString(hash)
+	default:
+		return hex.EncodeToString(hash)
+	}
+}
+
+// encodeBase encodes a hash as a number in the given base, using big.Int's digits
+// (0-9, a-z, A-Z). The result is left-padded with zeros to the number of digits
+// needed for the largest possible hash of the same length so that the length
+// doesn't depend on the hash's value.
+func encodeBase(hash []byte, base int) string {
+	encoded := new(big.Int).SetBytes(hash).Text(base)
+
+	largest := new(big.Int).Lsh(big.NewInt(1), uint(len(hash))*8)
+	largest.Sub(largest, big.NewInt(1))
+	width := len(largest.Text(base))
+
+	if len(encoded) < width {
+		encoded = strings.Repeat("0", width-len(encoded)) + encoded
+	}
+	return encoded
+}
+
+// chars returns a regular expression character class matching every character used
+// by the encoding.
+func (e Encoding) chars() string {
+	switch e {
+	case EncodingBase32:
+		return `[a-z2-7]`
+	case EncodingBase36:
+		return `[0-9a-z]`
+	case EncodingBase62:
+		return `[0-9a-zA-Z]`
+	case EncodingBase64URL:
+		return `[0-9a-zA-Z_-]`
+	default:
+		return `[0-9a-f]`
+	}
+}
@@ -0,0 +1,106 @@
+package hashfs
+
+import (
+	"encoding/base64"
+	"io/fs"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestHashEncoding(t *testing.T) {
+	fileContents, err := fs.ReadFile(fsys, "testdata/subdir1/script.js")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	tests := []struct {
+		name     string
+		encoding Encoding
+		length   int
+		charset  *regexp.Regexp
+	}{
+		{"Hex", EncodingHex, 64, regexp.MustCompile(`^[0-9a-f]+$`)},
+		{"Base32", EncodingBase32, 52, regexp.MustCompile(`^[a-z2-7]+$`)},
+		{"Base36", EncodingBase36, 50, regexp.MustCompile(`^[0-9a-z]+$`)},
+		{"Base62", EncodingBase62, 43, regexp.MustCompile(`^[0-9a-zA-Z]+$`)},
+		{"Base64URL", EncodingBase64URL, 43, regexp.MustCompile(`^[0-9a-zA-Z_-]+$`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hfs := NewFS(fsys, HashEncoding(tt.encoding))
+			hash := hfs.calculateHash(fileContents)
+			if len(hash) != tt.length {
+				t.Fatalf("bad length; \ngot:  %d, \nwant: %d", len(hash), tt.length)
+				return
+			}
+			if !tt.charset.MatchString(hash) {
+				t.Fatal("bad characters in hash", hash)
+				return
+			}
+
+			//Every hash must be the same length, even for a hash with leading zeros.
+			if got := len(tt.encoding.encode(make([]byte, 32))); got != tt.length {
+				t.Fatalf("bad length for zero hash; \ngot:  %d, \nwant: %d", got, tt.length)
+				return
+			}
+
+			//Hash paths must still be resolvable and served with a matching ETag.
+			for _, location := range []optionFunc{HashLocationStart(), HashLocationFirstPeriod(), HashLocationEnd()} {
+				hfs := NewFS(fsys, HashEncoding(tt.encoding), HashLength(12), location)
+				hashPath := hfs.GetHashPath("testdata/subdir1/script.js")
+
+				_, parsedHash, ok := hfs.parseHashPath(hashPath)
+				if !ok || parsedHash != hash[:12] {
+					t.Fatalf("bad parsed hash for %s; \ngot:  %s, \nwant: %s", hashPath, parsedHash, hash[:12])
+					return
+				}
+
+				r := httptest.NewRequest("GET", "/"+hashPath, nil)
+				w := httptest.NewRecorder()
+				FileServer(NewFS(fsys, HashEncoding(tt.encoding), HashLength(12), location)).ServeHTTP(w, r)
+				if w.Code != http.StatusOK {
+					t.Fatal("bad code", w.Code, hashPath)
+					return
+				}
+				if got := w.Header().Get("ETag"); got != entityTag(hash[:12], "") {
+					t.Fatalf("bad etag; \ngot:  %s, \nwant: %s", got, entityTag(hash[:12], ""))
+					return
+				}
+			}
+		})
+	}
+
+	t.Run("Values", func(t *testing.T) {
+		h := HasherSHA256.New()
+		h.Write(fileContents)
+		sum := h.Sum(nil)
+
+		if got, want := EncodingBase64URL.encode(sum), base64.RawURLEncoding.EncodeToString(sum); got != want {
+			t.Fatalf("bad base64url; \ngot:  %s, \nwant: %s", got, want)
+			return
+		}
+
+		for _, base := range []int{36, 62} {
+			n, ok := new(big.Int).SetString(encodeBase(sum, base), base)
+			if !ok || n.Cmp(new(big.Int).SetBytes(sum)) != 0 {
+				t.Fatalf("base%d does not decode to the hash", base)
+				return
+			}
+		}
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatal("panic should have occured for bad hash encoding")
+			}
+		}()
+
+		_ = NewFS(fsys, HashEncoding(Encoding(100)))
+	})
+}
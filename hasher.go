@@ -0,0 +1,78 @@
+package hashfs
+
+import (
+	"crypto"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"hash/crc64"
+	"hash/fnv"
+)
+
+// Hasher creates the hash.Hash used to calculate the hash of each file's contents.
+// Implement this to use a hash algorithm not provided by this package.
+type Hasher interface {
+	//New returns a new hash.Hash. A new hash.Hash is created for each file.
+	New() hash.Hash
+
+	//Name returns the name of the hash algorithm, i.e. "sha256".
+	Name() string
+}
+
+// stdHasher is a Hasher for a hash algorithm from the standard library. Pointers are
+// used so that Hashers can be compared.
+type stdHasher struct {
+	name string
+	new  func() hash.Hash
+}
+
+func (s stdHasher) New() hash.Hash {
+	return s.new()
+}
+
+func (s stdHasher) Name() string {
+	return s.name
+}
+
+// crc64Table is the table used by HasherCRC64.
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+// Hashers for use with the HashWith option.
+//
+// The FNV-1a and CRC-64 hashers are not cryptographic hashes, but are much faster,
+// which may be helpful if you have a huge number of files. They are still more than
+// good enough for cache-busting.
+var (
+	HasherMD5        Hasher = &stdHasher{"md5", md5.New}
+	HasherSHA1       Hasher = &stdHasher{"sha1", sha1.New}
+	HasherSHA256     Hasher = &stdHasher{"sha256", sha256.New}
+	HasherSHA512     Hasher = &stdHasher{"sha512", sha512.New}
+	HasherSHA512_256 Hasher = &stdHasher{"sha512/256", sha512.New512_256}
+	HasherFNV1a64    Hasher = &stdHasher{"fnv1a-64", func() hash.Hash { return fnv.New64a() }}
+	HasherFNV1a128   Hasher = &stdHasher{"fnv1a-128", fnv.New128a}
+	HasherCRC64      Hasher = &stdHasher{"crc64", func() hash.Hash { return crc64.New(crc64Table) }}
+)
+
+// cryptoHashers maps the algorithms supported by the HashAlgo option to Hashers.
+var cryptoHashers = map[crypto.Hash]Hasher{
+	crypto.MD5:        HasherMD5,
+	crypto.SHA1:       HasherSHA1,
+	crypto.SHA256:     HasherSHA256,
+	crypto.SHA512:     HasherSHA512,
+	crypto.SHA512_256: HasherSHA512_256,
+}
+
+// HashWith sets the Hasher used to calculate the hash of each file's contents.
+// Default is HasherSHA256. Use one of the provided Hashers, i.e. HasherFNV1a64, or
+// your own implementation. This will panic if h is nil.
+func HashWith(h Hasher) optionFunc {
+	return func(hfs *HFS) {
+		if h == nil {
+			panic("nil hasher used")
+		}
+
+		hfs.hasher = h
+	}
+}
@@ -14,9 +14,13 @@ contents to the filename.
   - Call [hashfs.NewFS] before parsing your HTML templates.
   - Define a func to call [HFS.GetHashPath], and add it to your [html/template.FuncMap].
   - Modify your HTML templates to use the func defined in your [html/template.FuncMap]
-    for each static file you want to cache-bust.
+    for each static file you want to cache-bust. Alternatively, use the ready-made
+    funcs from [HFS.FuncMap].
   - Call [hashfs.FileServer] in your HTTP router on the endpoint you serve static
     files from.
+  - Optionally, provide the [URLPrefix] option to [hashfs.NewFS] so that full URL
+    paths can be used with [HFS.GetHashPath] and [hashfs.FileServer] doesn't need
+    to be wrapped in [net/http.StripPrefix].
 
 # Example:
 See the example/example.go file in the source repo.
@@ -24,13 +28,6 @@ See the example/example.go file in the source repo.
 # Example FuncMap func:
 
 	  func static(originalPath string) (hashPath string) {
-		//If in development mode, just return path as-is. We will serve a non-cache-
-		//busted version of the file since during development we refresh the browser
-		//a lot and don't want to cache things mistakenly.
-		if devMode {
-			return originalPath
-		}
-
 		//Trim path, if needed.
 		//
 		//For example, if your static files are served off of www.example.co/static/
@@ -50,6 +47,10 @@ See the example/example.go file in the source repo.
 		return path.Join("/", "static", hashPath)
 	  }
 
+In development, provide the [DevMode] option to [hashfs.NewFS] rather than checking
+for development mode in your func. Original paths will be returned and served
+without aggressive caching.
+
 # Definitions:
   - original path: the path to the on-disk source file.
   - hash path: the path where the filename includes the hash of the file's contents.
@@ -60,14 +61,14 @@ package hashfs
 
 import (
 	"crypto"
-	"crypto/md5"
-	"crypto/sha256"
-	"encoding/hex"
+	"errors"
+	"fmt"
 	"io"
 	"io/fs"
 	"net/http"
 	"os"
 	"path"
+	"runtime"
 	"strconv"
 	"strings"
 	"sync"
@@ -91,9 +92,45 @@ type HFS struct {
 
 	//Options.
 	hashLocation hashLocation
-	hashAlgo     crypto.Hash
+	hasher       Hasher
+	hashEncoding Encoding
 	maxAge       time.Duration
 	hashLength   uint
+	precompute   bool
+	urlPrefix    string
+	devMode      bool
+
+	//A filename pattern, if provided, overrides the hash location.
+	filenamePattern *filenamePattern
+
+	//The hash of every file in the fs.FS, when HashLocationTree is used.
+	treeMu sync.Mutex
+	tree   string
+
+	//Subresource Integrity.
+	integrityAlgo crypto.Hash
+
+	//Rewriting references to other files within a file's contents, keyed by file
+	//extension.
+	rewriters map[string]rewriteFunc
+
+	//On-the-fly compression. The cache is keyed by hash path.
+	compressCacheSize uint
+	compressMu        sync.Mutex
+	compressCache     map[string][]byte
+	compressCacheUsed uint
+
+	//Redirecting original paths, and stale hash paths, to current hash paths.
+	redirectOriginalStatus   int
+	redirectOriginalPatterns []string
+	redirectStaleStatus      int
+
+	//Retaining the contents of hashed files for serving after they change.
+	retentionStore RetentionStore
+
+	//Options for loading a manifest.
+	verifyManifest       bool
+	verifyManifestSample uint
 }
 
 // reverse stores the original name and the calculated hash for a file for use in
@@ -106,11 +143,52 @@ type HFS struct {
 //
 // The hash is used to set the Etag header. This way we don't have to "rip out" the
 // hash from the hashPath.
+//
+// The size is stored for use in the manifest. The integrity is the Subresource
+// Integrity value, calculated at the same time as the hash.
+//
+// The content is only stored if the file's contents were rewritten, i.e. references
+// to other files in CSS were replaced with hash paths, since the rewritten content
+// must be served rather than the on-disk source file.
+//
+// The info is the source file's info from when the hash was calculated and is used
+// by Watch to detect changes. This is nil for entries loaded from a manifest.
 type reverse struct {
 	originalPath string
 	hash         string
+	size         int64
+	integrity    string
+	content      []byte
+	info         fs.FileInfo
 }
 
+// Errors returned by GetHashPathE and NewFSFromManifest. These are wrapped with the
+// path to the file that caused the error, so use errors.Is to check for them.
+var (
+	//ErrNotExist is returned when the file at the provided original path does not
+	//exist. This also matches fs.ErrNotExist.
+	ErrNotExist = fmt.Errorf("hashfs: %w", fs.ErrNotExist)
+
+	//ErrIsDir is returned when the provided original path is a directory.
+	ErrIsDir = errors.New("hashfs: is a directory")
+
+	//ErrHashCollision is returned when the hash path calculated for a file is
+	//already used by a different file.
+	ErrHashCollision = errors.New("hashfs: hash collision")
+
+	//ErrInvalidHashPath is returned when a hash path, such as in a manifest, is not
+	//a valid path in an fs.FS.
+	ErrInvalidHashPath = errors.New("hashfs: invalid hash path")
+
+	//ErrHashMismatch is returned when the hash stored for a file, such as in a
+	//manifest, does not match the hash of the file's contents.
+	ErrHashMismatch = errors.New("hashfs: hash mismatch")
+
+	//ErrCycle is returned when rewriting references to other files results in a
+	//file referencing itself, i.e. a.css imports b.css which imports a.css.
+	ErrCycle = errors.New("hashfs: reference cycle")
+)
+
 // hashLocation defines the position of the hash in the filename.
 type hashLocation int
 
@@ -118,6 +196,9 @@ const (
 	hashLocationStart       hashLocation = iota //script.min.js -> a1b2c3...d4e5f6.script.min.js
 	hashLocationFirstPeriod                     //script.min.js -> script-a1b2c3...d4e5f6.min.js; original designed hash location
 	hashLocationEnd                             //script.min.js -> script.min.a1b2c3...d4e5f6.js
+	hashLocationDirectory                       //css/styles.css -> a1b2c3...d4e5f6/css/styles.css
+	hashLocationTree                            //css/styles.css -> a1b2c3...d4e5f6/css/styles.css, same hash for every file
+	hashLocationQueryString                     //css/styles.css -> css/styles.css?v=a1b2c3...d4e5f6
 
 	//default is "end" since this looks the best in browser dev tools.
 	//"first period" was the legacy location.
@@ -139,7 +220,8 @@ func NewFS(fsys fs.FS, options ...optionFunc) *HFS {
 		originalPathToHashPath: make(map[string]string),
 		hashPathReverse:        make(map[string]reverse),
 		hashLocation:           hashLocationDefault,
-		hashAlgo:               crypto.SHA256,
+		hasher:                 HasherSHA256,
+		integrityAlgo:          crypto.SHA384,
 		maxAge:                 time.Duration(365 * 24 * 60 * 60 * time.Second),
 	}
 
@@ -148,6 +230,21 @@ func NewFS(fsys fs.FS, options ...optionFunc) *HFS {
 		option(f)
 	}
 
+	//Prepare for parsing hash paths built from a filename pattern. This is done
+	//after every option is applied since it depends on the hash length and hash
+	//encoding.
+	if f.filenamePattern != nil {
+		f.filenamePattern.compile(len(f.calculateHash(nil)), f.hashEncoding.chars())
+	}
+
+	//Calculate the hash of every file now, if requested, rather than lazily when
+	//GetHashPath is first called for each file. Errors are ignored here since any
+	//file that could not be hashed will simply be hashed lazily, as usual. Call
+	//HashAll directly if you need to handle the errors.
+	if f.precompute && !f.devMode {
+		_ = f.HashAll()
+	}
+
 	return f
 }
 
@@ -204,20 +301,21 @@ func HashLocationFirstPeriod() optionFunc {
 }
 
 // HashAlgo specifies the algorithm to use to calculate the hash of each file's
-// contents. Default is SHA256. MD5 is what S3 uses. This will panic if an
-// unsupported algorithm is provided.
+// contents. Default is SHA256. MD5 is what S3 uses. MD5, SHA1, SHA256, SHA512, and
+// SHA512_256 are supported. This will panic if an unsupported algorithm is provided.
 //
 // This should rarely be needed, since typically you don't really care about the hash
 // algorithm. This is provided mostly for people who like looking at shorter MD5 sums.
+// Use the HashWith option for non-cryptographic hashes or your own Hasher.
 func HashAlgo(algo crypto.Hash) optionFunc {
 	return func(hfs *HFS) {
-		hfs.hashAlgo = algo
-
 		//Make sure given algorithm is one of our supported algorithms.
-		result := hfs.calculateHash([]byte("hello world"))
-		if result == "" {
+		h, ok := cryptoHashers[algo]
+		if !ok {
 			panic("unsupported hash algorithm used")
 		}
+
+		hfs.hasher = h
 	}
 }
 
@@ -238,9 +336,9 @@ func MaxAge(d time.Duration) optionFunc {
 }
 
 // HashLength trims the length of the hash added to a filename. Default is the full
-// hash length, based on the hash algorithm. Values less than 8 should not be used
-// since a collision is highly likely. If 0 is provided, the default hash length is
-// used.
+// hash length, based on the hash algorithm and hash encoding. The length is in
+// characters of the hash encoding. Values less than 8 should not be used since a
+// collision is highly likely. If 0 is provided, the default hash length is used.
 //
 // This should rarely be needed, since typically you want as long of a hash as possible
 // to alleviate collision concerns. This is helpful if you want shorter filenames.
@@ -254,6 +352,95 @@ func HashLength(l uint) optionFunc {
 	}
 }
 
+// Precompute calculates the hash of every file in the fs.FS when NewFS is called,
+// rather than lazily the first time GetHashPath is called for each file. Any errors
+// are ignored; files that could not be hashed will be hashed lazily as usual. Call
+// HFS.HashAll directly instead if you need to handle errors.
+//
+// This is helpful for making cold starts predictable since the first request for a
+// page doesn't pay the cost of reading and hashing every static file. This also
+// allows FileServer to serve hash paths before any template has been rendered.
+func Precompute() optionFunc {
+	return func(hfs *HFS) {
+		hfs.precompute = true
+	}
+}
+
+// URLPrefix sets the URL path your static files are served from, i.e. "/static/".
+// This allows GetHashPath to accept and return full URL paths and causes FileServer
+// to remove the prefix from requested URLs itself, so you don't need to trim the
+// prefix before calling GetHashPath, add it back afterwards, or wrap FileServer in
+// http.StripPrefix.
+//
+//	hfs := hashfs.NewFS(fsys, hashfs.URLPrefix("/static/"))
+//	hfs.GetHashPath("/static/css/styles.css") //returns /static/css/styles.css-a1b2c3...d4e5f6.css
+//	http.Handle("/static/", hashfs.FileServer(hfs))
+//
+// The lookup tables, and the manifest, still use paths relative to the root of the
+// fs.FS.
+func URLPrefix(prefix string) optionFunc {
+	return func(hfs *HFS) {
+		hfs.urlPrefix = normalizePrefix(prefix)
+	}
+}
+
+// normalizePrefix makes sure a URL path prefix starts and ends with a slash so that
+// paths can be joined to it without worrying about double or missing slashes. This
+// also makes sure the prefix only matches whole path segments, i.e. /static/ does
+// not match /staticx/.
+func normalizePrefix(prefix string) string {
+	prefix = "/" + strings.Trim(prefix, "/") + "/"
+	if prefix == "//" {
+		prefix = "/"
+	}
+
+	return prefix
+}
+
+// DevMode is used during development so that changes to files are picked up
+// without restarting your binary and browsers never cache stale files. Typically
+// this is set based on a flag or environment variable so that the same code is used
+// in development and production.
+//
+// When enabled:
+//   - GetHashPath returns the original path; no hash is calculated. Errors are
+//     still returned by GetHashPathE for missing files.
+//   - Nothing is cached in the lookup tables, so the contents are always read from
+//     the fs.FS.
+//   - FileServer sends "Cache-Control: no-cache" with an ETag of the file's current
+//     content hash, so browsers revalidate on every request.
+//   - Rewriting of references within files is skipped since references already
+//     point to original paths.
+//   - Precompute is ignored.
+func DevMode() optionFunc {
+	return func(hfs *HFS) {
+		hfs.devMode = true
+	}
+}
+
+// trimURLPrefix returns the path in the fs.FS for a path that may be a full URL path
+// including the URLPrefix. Paths without the URLPrefix are returned as-is, apart from
+// any leading slash, since they are assumed to already be paths in the fs.FS.
+func (hfs *HFS) trimURLPrefix(p string) string {
+	if hfs.urlPrefix == "" {
+		return p
+	}
+
+	if trimmed, found := strings.CutPrefix(p, hfs.urlPrefix); found {
+		return trimmed
+	}
+	return strings.TrimPrefix(p, "/")
+}
+
+// addURLPrefix returns the full URL path for a path in the fs.FS.
+func (hfs *HFS) addURLPrefix(p string) string {
+	if hfs.urlPrefix == "" {
+		return p
+	}
+
+	return hfs.urlPrefix + p
+}
+
 // Open returns a reference to the file at the provided path. The path could be an
 // original path or a hash path. If a hash path is given, the original path will be
 // looked up to return the file with.
@@ -269,9 +456,14 @@ func (hfs *HFS) Open(path string) (f fs.File, err error) {
 // original path or a hash path. If a hash path is given, the original path will be
 // looked up to return the file with.
 //
-// This differs from Open because the hash of the file at the provided path is also
-// returned. The hash is used to set the Etag header.
-func (hfs *HFS) open(path string) (f fs.File, hash string, err error) {
+// This differs from Open because the lookup table information for the file is also
+// returned. The hash is used to set the Etag header and the original path is used to
+// look up precompressed versions of the file. If the path is not a known hash path,
+// the returned hash will be blank and the original path will be the given path.
+//
+// If the file's contents were rewritten, the rewritten contents are returned rather
+// than the on-disk source file.
+func (hfs *HFS) open(path string) (f fs.File, rev reverse, err error) {
 	//Try looking up the path in our table of hash paths. If the path is found, this
 	//means the given path is a hash path. The returned original path can be used to
 	//look up the underlying source file.
@@ -279,15 +471,64 @@ func (hfs *HFS) open(path string) (f fs.File, hash string, err error) {
 	//If the path is not found, than most likely the path is an original path. Just
 	//use it as-is to look up the source file.
 	hfs.mu.RLock()
-	defer hfs.mu.RUnlock()
-	reverse, exists := hfs.hashPathReverse[path]
-	if exists {
-		hash = reverse.hash
-		path = reverse.originalPath
+	rev, exists := hfs.hashPathReverse[path]
+	hfs.mu.RUnlock()
+	if !exists {
+		rev, exists = hfs.resolveHashPath(path)
+	}
+	if !exists {
+		rev = reverse{originalPath: path}
 	}
 
-	f, err = hfs.fsys.Open(path)
-	return
+	f, err = hfs.fsys.Open(rev.originalPath)
+	if err != nil || rev.hash == "" || !hfs.rewrites(rev.originalPath) {
+		return
+	}
+
+	//Handle files whose contents are rewritten.
+	//
+	//The rewritten contents will not be stored yet if the lookup tables were loaded
+	//from a manifest, so rewrite the contents now and store them for future use.
+	if rev.content == nil {
+		content, _, err := hfs.readFile(rev.originalPath, nil)
+		if err != nil {
+			f.Close()
+			return nil, rev, err
+		}
+
+		//The hash path may have been invalidated, i.e. by Watch, while the contents
+		//were being rewritten. The rewritten contents may not match the hash, so the
+		//hash path is treated as no longer existing.
+		rev.content = content
+		if !hfs.updateReverse(path, rev) {
+			f.Close()
+			return nil, rev, fmt.Errorf("%w: %s", ErrNotExist, path)
+		}
+	}
+
+	info, err := f.Stat()
+	f.Close()
+	if err != nil {
+		return nil, rev, err
+	}
+
+	return newMemFile(rev.content, info), rev, nil
+}
+
+// updateReverse stores rev, with lazily calculated information added, in the reverse
+// lookup table. rev is not stored if hashPath is no longer the current hash path of
+// the file, i.e. Invalidate or Watch removed it after it was looked up, since that
+// would bring back a stale hash path. False is returned if rev was not stored.
+func (hfs *HFS) updateReverse(hashPath string, rev reverse) bool {
+	hfs.mu.Lock()
+	defer hfs.mu.Unlock()
+
+	if hfs.originalPathToHashPath[rev.originalPath] != hashPath {
+		return false
+	}
+
+	hfs.hashPathReverse[hashPath] = rev
+	return true
 }
 
 // GetHashPath returns the hashPath for a provided originalPath. The hashPath is the
@@ -296,71 +537,401 @@ func (hfs *HFS) open(path string) (f fs.File, hash string, err error) {
 // has not already been done so. The hash will be saved to for future reuse and to
 // prevent unnecessary recalculation of the hash each time the same originalPath is
 // requested.
+//
+// If the hash cannot be calculated, the originalPath is returned so that the file
+// can still be served, just without cache-busting. Use GetHashPathE if you need to
+// know about errors.
+//
+// If the URLPrefix option was provided, the originalPath may be a full URL path,
+// i.e. /static/css/styles.css, and the returned hashPath will be a full URL path.
 func (hfs *HFS) GetHashPath(originalPath string) (hashPath string) {
+	hashPath, err := hfs.GetHashPathE(originalPath)
+	if err != nil {
+		return originalPath
+	}
+
+	return
+}
+
+// GetHashPathE is the same as GetHashPath except an error is returned if the hash
+// cannot be calculated, rather than silently returning the originalPath. Errors
+// wrap ErrNotExist, ErrIsDir, or ErrHashCollision, where appropriate, along with
+// the originalPath.
+//
+// This is useful in an html/template.FuncMap since a func that returns a non-nil
+// error will cause the template to fail to execute. This way, a typo in a path
+// to a static file is caught rather than quietly serving a non-cache-busted URL.
+func (hfs *HFS) GetHashPathE(originalPath string) (hashPath string, err error) {
+	hashPath, err = hfs.getHashPath(hfs.trimURLPrefix(originalPath), nil)
+	if err != nil {
+		return
+	}
+
+	return hfs.addURLPrefix(hashPath), nil
+}
+
+// getHashPath returns the hashPath for a provided originalPath, calculating the hash
+// if needed.
+//
+// The chain is the list of files that are having their references rewritten and
+// led to this file being hashed. This is used to detect reference cycles.
+func (hfs *HFS) getHashPath(originalPath string, chain []string) (hashPath string, err error) {
+	//In development mode, just make sure the file exists so that typos are still
+	//caught. The original path is always used and nothing is cached.
+	if hfs.devMode {
+		info, err := fs.Stat(hfs.fsys, originalPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("%w: %s", ErrNotExist, originalPath)
+		} else if err != nil {
+			return "", err
+		} else if info.IsDir() {
+			return "", fmt.Errorf("%w: %s", ErrIsDir, originalPath)
+		}
+
+		return originalPath, nil
+	}
+
 	//Check if hashPath has already been created and is cached.
 	hfs.mu.RLock()
 	hp, exists := hfs.originalPathToHashPath[originalPath]
 	if exists {
 		hfs.mu.RUnlock()
-		return hp
+		return hp, nil
 	}
 	hfs.mu.RUnlock()
 
 	//Hash has not already been calculated, look up file and calculate hash.
-	//
-	//On error, just return the original filename this way the file can still
-	//be served.
-	//TODO: somehow notify of this error? log = ugly. panic = ugly. return err?
-	fileContents, err := fs.ReadFile(hfs.fsys, originalPath)
+	return hfs.hashFile(originalPath, chain)
+}
+
+// hashFile reads the file at the originalPath, calculates the hash of its contents,
+// builds the hashPath, and stores the mappings in the lookup tables for future use.
+func (hfs *HFS) hashFile(originalPath string, chain []string) (hashPath string, err error) {
+	//Get the file's info, for detecting changes later on. This is done before the
+	//file is read so that a change made while reading is still detected. Any error
+	//will be handled when the file is read.
+	info, _ := fs.Stat(hfs.fsys, originalPath)
+
+	//Read the file.
+	fileContents, rewritten, err := hfs.readFile(originalPath, chain)
 	if err != nil {
-		return originalPath
+		return
 	}
 
-	//Calculate the hash.
+	//Calculate the hash and the Subresource Integrity value.
 	hash := hfs.calculateHash(fileContents)
+	integrity := hfs.calculateIntegrity(fileContents)
 
-	//Add the hash the filename.
-	//Format the filename with the hash.
-	dir, filename := path.Split(originalPath)
-	fileNameWithHash := hfs.addHashToFilname(filename, hash)
-
-	//Build the path to the file with the hash filename.
-	hashPath = path.Join(dir, fileNameWithHash)
+	//Build the path to the file with the hash added to the filename.
+	pathHash, err := hfs.pathHash(hash)
+	if err != nil {
+		return
+	}
+	hashPath = hfs.buildHashPath(originalPath, pathHash)
 
 	//Store mappings for reuse in the future.
+	//
+	//Make sure the hashPath isn't already used by a different file. This should
+	//really never happen, but could if a very short HashLength is used.
 	hfs.mu.Lock()
+	if rev, exists := hfs.hashPathReverse[hashPath]; exists && rev.originalPath != originalPath {
+		hfs.mu.Unlock()
+		return "", fmt.Errorf("%w: %s and %s", ErrHashCollision, originalPath, rev.originalPath)
+	}
+
+	rev := reverse{
+		originalPath: originalPath,
+		hash:         hash,
+		size:         int64(len(fileContents)),
+		integrity:    integrity,
+		info:         info,
+	}
+	if rewritten {
+		rev.content = fileContents
+	}
+
 	hfs.originalPathToHashPath[originalPath] = hashPath
-	hfs.hashPathReverse[hashPath] = reverse{originalPath, hash}
+	hfs.hashPathReverse[hashPath] = rev
 	hfs.mu.Unlock()
 
+	//Store the contents for serving after the file changes, if needed.
+	hfs.retain(hashPath, fileContents)
 	return
 }
 
-// calculateHash calculates the hash of a file's contents and returns it with hex
-// encoding. If a non-supported hash algorithm is set, the resulting encodedHash will
-// be blank (""), however, this should have already been cause in the HashAlgo option
-// func when NewFS was called.
-func (hfs *HFS) calculateHash(fileContents []byte) (encodedHash string) {
-	var hash []byte
-
-	switch hfs.hashAlgo {
-	case crypto.SHA256:
-		h := sha256.Sum256(fileContents)
-		hash = []byte(h[:])
-	case crypto.MD5:
-		h := md5.Sum(fileContents)
-		hash = []byte(h[:])
+// readFile reads the contents of the file at the originalPath, rewriting references
+// to other files if needed. This returns the contents that are hashed and served.
+//
+// The chain is the list of files that are having their references rewritten and
+// led to this file being read. This is used to detect reference cycles.
+func (hfs *HFS) readFile(originalPath string, chain []string) (fileContents []byte, rewritten bool, err error) {
+	//Make sure this file isn't already being rewritten, otherwise we would end up
+	//in an infinite loop.
+	for _, p := range chain {
+		if p == originalPath {
+			return nil, false, fmt.Errorf("%w: %s", ErrCycle, strings.Join(append(chain, originalPath), " -> "))
+		}
+	}
+
+	//The file is opened and stat-ed, rather than just using fs.ReadFile, so that
+	//we can catch if a directory was mistakenly provided.
+	f, err := hfs.fsys.Open(originalPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, fmt.Errorf("%w: %s", ErrNotExist, originalPath)
+	} else if err != nil {
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return
+	} else if info.IsDir() {
+		return nil, false, fmt.Errorf("%w: %s", ErrIsDir, originalPath)
+	}
+
+	fileContents, err = io.ReadAll(f)
+	if err != nil {
+		return
+	}
+
+	//Rewrite references to other files, if needed.
+	if !hfs.rewrites(originalPath) {
+		return
+	}
+
+	rewrite := hfs.rewriters[path.Ext(originalPath)]
+	fileContents, err = rewrite(hfs, originalPath, fileContents, append(chain, originalPath))
+	if err != nil {
+		return nil, false, err
+	}
+
+	return fileContents, true, nil
+}
+
+// buildHashPath returns the path to the file with the hash added to the filename.
+func (hfs *HFS) buildHashPath(originalPath, hash string) (hashPath string) {
+	if hfs.filenamePattern != nil {
+		return hfs.filenamePattern.build(originalPath, hash)
+	}
+
+	//Add the hash as a leading directory, if needed.
+	if hfs.hashLocation == hashLocationDirectory || hfs.hashLocation == hashLocationTree {
+		return hash + "/" + originalPath
+	}
+
+	//Add the hash as a query string parameter, if needed.
+	if hfs.hashLocation == hashLocationQueryString {
+		return originalPath + "?" + queryStringParam + "=" + hash
+	}
+
+	dir, filename := path.Split(originalPath)
+	fileNameWithHash := hfs.addHashToFilname(filename, hash)
+
+	return path.Join(dir, fileNameWithHash)
+}
+
+// parseHashPath extracts the original path and the hash from a path that may be a
+// hash path, based on the hash location and hash length. False is returned if the
+// path could not be a hash path. The filename pattern is used, if provided.
+//
+// The extracted hash is not validated against the file's contents.
+func (hfs *HFS) parseHashPath(hashPath string) (originalPath, hash string, ok bool) {
+	//Parse using the filename pattern, if provided.
+	if hfs.filenamePattern != nil {
+		originalPath, hash, ok = hfs.filenamePattern.parse(hashPath)
+		if !ok || hfs.buildHashPath(originalPath, hash) != hashPath {
+			return "", "", false
+		}
+
+		return originalPath, hash, true
+	}
+
+	//Every hash has the same length, so get the length from the hash of nothing.
+	n := len(hfs.calculateHash(nil))
+
+	//Parse the hash from the leading directory, if needed.
+	//
+	//a1b2c3...d4e5f6/css/styles.css
+	if hfs.hashLocation == hashLocationDirectory || hfs.hashLocation == hashLocationTree {
+		hash, originalPath, found := strings.Cut(hashPath, "/")
+		if !found || len(hash) != n || !fs.ValidPath(originalPath) {
+			return "", "", false
+		}
+
+		return originalPath, hash, true
+	}
+
+	//Parse the hash from the query string parameter, if needed.
+	//
+	//css/styles.css?v=a1b2c3...d4e5f6
+	if hfs.hashLocation == hashLocationQueryString {
+		originalPath, hash, found := strings.Cut(hashPath, "?"+queryStringParam+"=")
+		if !found || len(hash) != n || strings.ContainsAny(hash, "/?&#") || !fs.ValidPath(originalPath) {
+			return "", "", false
+		}
+
+		return originalPath, hash, true
+	}
+
+	dir, name := path.Split(hashPath)
+	if len(name) <= n+1 {
+		return "", "", false
+	}
+
+	var originalName string
+	switch hfs.hashLocation {
+	case hashLocationStart:
+		//a1b2c3...d4e5f6-script.min.js
+		hash = name[:n]
+		originalName = name[n+1:]
+
+	case hashLocationFirstPeriod:
+		//script-a1b2c3...d4e5f6.min.js, or script-a1b2c3...d4e5f6 if the original
+		//name didn't have a period.
+		i := strings.Index(name, ".")
+		if i == -1 {
+			i = len(name)
+		}
+		if i < n+1 {
+			return "", "", false
+		}
+
+		hash = name[i-n : i]
+		originalName = name[:i-n-1] + name[i:]
+
+	case hashLocationEnd:
+		//script.min.js-a1b2c3...d4e5f6.js
+		ext := path.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		if len(base) < n+1 {
+			return "", "", false
+		}
+
+		hash = base[len(base)-n:]
+		originalName = base[:len(base)-n-1]
+
 	default:
-		//This should never occur since we check if the hash algorithm is supported
-		//when NewFS is called. This is here mostly for tests.
-		hash = []byte("")
+		return "", "", false
+	}
+
+	//Make sure the hash path is exactly what we would have built. This catches the
+	//separator being missing and any other mismatch in the filename.
+	originalPath = path.Join(dir, originalName)
+	if originalName == "" || hfs.buildHashPath(originalPath, hash) != hashPath {
+		return "", "", false
+	}
+
+	return originalPath, hash, true
+}
+
+// resolveHashPath looks up a hash path that is not in the lookup tables by parsing
+// the original path from the hash path and hashing the original file. This allows
+// serving hash paths that were returned by GetHashPath in another process, i.e. by
+// another replica of your app, before this process has hashed the file.
+//
+// False is returned if the path is not a hash path or the hash doesn't match the
+// file's current contents.
+func (hfs *HFS) resolveHashPath(hashPath string) (rev reverse, ok bool) {
+	originalPath, _, ok := hfs.parseHashPath(hashPath)
+	if !ok {
+		return reverse{}, false
+	}
+
+	hp, err := hfs.getHashPath(originalPath, nil)
+	if err != nil || hp != hashPath {
+		return reverse{}, false
+	}
+
+	hfs.mu.RLock()
+	rev, ok = hfs.hashPathReverse[hashPath]
+	hfs.mu.RUnlock()
+	return
+}
+
+// HashAll walks the fs.FS and calculates the hash of every file, storing the results
+// in the lookup tables. Files are hashed concurrently using a bounded pool of workers.
+// Any errors encountered while walking the fs.FS or hashing files are joined together
+// and returned; files that were hashed successfully are stored regardless.
+//
+// This is typically called via the Precompute option to NewFS, but can be called
+// directly if you need to handle any errors.
+func (hfs *HFS) HashAll() error {
+	//Get the list of files to hash.
+	//
+	//Errors are collected, rather than stopping the walk, so that as many files as
+	//possible are hashed.
+	var (
+		paths []string
+		errs  []error
+	)
+	walkErr := fs.WalkDir(hfs.fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		paths = append(paths, p)
+		return nil
+	})
+	if walkErr != nil {
+		errs = append(errs, walkErr)
+	}
+
+	//Hash each file using a bounded number of workers. There is no need to have
+	//more workers than files.
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(paths) {
+		workers = len(paths)
+	}
+
+	var (
+		wg    sync.WaitGroup
+		errMu sync.Mutex
+		work  = make(chan string)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range work {
+				if _, err := hfs.getHashPath(p, nil); err != nil {
+					errMu.Lock()
+					errs = append(errs, err)
+					errMu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, p := range paths {
+		work <- p
 	}
+	close(work)
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// calculateHash calculates the hash of a file's contents, using the Hasher, and
+// returns it encoded with the hash encoding.
+func (hfs *HFS) calculateHash(fileContents []byte) (encodedHash string) {
+	h := hfs.hasher.New()
+	h.Write(fileContents)
 
-	encodedHash = hex.EncodeToString(hash[:])
+	encodedHash = hfs.hashEncoding.encode(h.Sum(nil))
 
-	//Check if the encoded hash should be trimmed to a certain length.
-	if hfs.hashLength > 0 && int(hfs.hashLength) < len(encodedHash) {
-		encodedHash = encodedHash[:hfs.hashLength]
+	//Check if the encoded hash should be trimmed to a certain length. A length in
+	//the filename pattern overrides the HashLength option.
+	hashLength := hfs.hashLength
+	if hfs.filenamePattern != nil && hfs.filenamePattern.hashLength > 0 {
+		hashLength = hfs.filenamePattern.hashLength
+	}
+	if hashLength > 0 && int(hashLength) < len(encodedHash) {
+		encodedHash = encodedHash[:hashLength]
 	}
 
 	return
@@ -378,6 +949,12 @@ func (hfs *HFS) addHashToFilname(originalName, hash string) (hashName string) {
 		return
 	}
 
+	//Use the filename pattern, if provided.
+	if hfs.filenamePattern != nil {
+		hashName = hfs.filenamePattern.build(originalName, hash)
+		return
+	}
+
 	//Add the hash to the filename.
 	switch hfs.hashLocation {
 	case hashLocationFirstPeriod:
@@ -430,8 +1007,32 @@ type hfsHandler struct {
 // http.FileServer. Ex.: http.FileServer(http.FS(someStaticFS)) -> hashfs.FileServer(hfs).
 //
 // Because FileServer is focused on small known path files, several features
-// of http.FileServer have been removed including canonicalizing directories,
-// defaulting index.html pages, precondition checks, & content range headers.
+// of http.FileServer have been removed including canonicalizing directories &
+// defaulting index.html pages.
+//
+// Hash paths are served with a strong ETag so conditional requests (If-None-Match,
+// If-Match, & If-Range) are handled, i.e. a browser revalidating a file receives a
+// 304 Not Modified response.
+//
+// Hash paths that have not been returned by GetHashPath in this process, i.e. hash
+// paths rendered by another replica of your app, are parsed to find the original
+// file which is then hashed. The file is only served as a hash path if the hash
+// matches the file's current contents.
+//
+// If the URLPrefix option was provided, the prefix is removed from the requested URL
+// so there is no need to use http.StripPrefix.
+//
+// Requests for original paths, and hash paths with an outdated hash, can be
+// redirected to the current hash path using the RedirectOriginalPaths and
+// RedirectStaleHashPaths options.
+//
+// If the QueryStringMode option was provided, the hash is taken from the v query
+// string parameter and aggressive caching headers are only set if it matches the
+// file's current hash.
+//
+// If a precompressed version of a file exists alongside the file (i.e.: script.js.br,
+// script.js.zst, or script.js.gz next to script.js), it will be served when a hash
+// path is requested and the browser accepts the encoding.
 func FileServer(fsys fs.FS) http.Handler {
 	//Check if the fsys is actually our custom HFS that encapsulates an fs.FS.
 	hfs, ok := fsys.(*HFS)
@@ -451,6 +1052,18 @@ func (hh *hfsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	//an original path if a hash was never calculated for the file.
 	filePath := r.URL.Path
 
+	//Remove the URL prefix, if needed. Requests outside of the prefix cannot be
+	//for files in our fs.FS.
+	if hh.hfs.urlPrefix != "" {
+		trimmed, found := strings.CutPrefix(filePath, hh.hfs.urlPrefix)
+		if !found {
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return
+		}
+
+		filePath = "/" + trimmed
+	}
+
 	// Clean up filePath based on URL path.
 	if filePath == "/" {
 		filePath = "."
@@ -459,14 +1072,38 @@ func (hh *hfsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	filePath = path.Clean(filePath)
 
+	//Get the hash path from the query string, if needed. Requests without the
+	//file's current hash are served the current version of the file, but are only
+	//cached briefly.
+	hashPath := filePath
+	stale := false
+	if hh.hfs.queryStringMode() {
+		var handled bool
+		hashPath, stale, handled = hh.hfs.resolveQueryString(w, r, filePath)
+		if handled {
+			return
+		}
+	}
+
 	// Get the file from our fs.FS.
 	//
-	//This will look up the original file if the filePath is a hash path. If the
-	//filePath is an original path (i.e. we don't have this original path in our
+	//This will look up the original file if the hashPath is a hash path. If the
+	//hashPath is an original path (i.e. we don't have this original path in our
 	//lookup tables), then the given path is used to look up the file with.
-	f, hash, err := hh.hfs.open(filePath)
+	f, rev, err := hh.hfs.open(hashPath)
 	if os.IsNotExist(err) {
-		//Handle if no file exists at the given path.
+		//Handle if no file exists at the given path. A previous version of the file
+		//may have been retained, i.e. during a rolling deploy.
+		if hh.hfs.serveRetained(w, r, hashPath) {
+			return
+		}
+
+		//Redirect to the current hash path if the hash path is just outdated, if
+		//needed.
+		if hh.hfs.redirectStale(w, r, hashPath) {
+			return
+		}
+
 		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		return
 	} else if err != nil {
@@ -475,7 +1112,10 @@ func (hh *hfsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
-	defer f.Close()
+	defer func() {
+		//Closure is used since f may be replaced with a precompressed file.
+		f.Close()
+	}()
 
 	//Get file's info.
 	//
@@ -491,6 +1131,12 @@ func (hh *hfsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	//Redirect requests for original paths to the hash path, if needed, so that the
+	//file is cached aggressively.
+	if rev.hash == "" && hh.hfs.redirectOriginal(w, r, filePath) {
+		return
+	}
+
 	//Set aggressive caching headers.
 	//
 	//We check if a hash exists to prevent setting caching headers on non-hashed
@@ -502,9 +1148,59 @@ func (hh *hfsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	//value. For some reason Cloudflare thinks they know better here about strong
 	//versus weak Etag values.
 	//https://developers.cloudflare.com/cache/reference/etag-headers/#strong-etags
-	if hash != "" {
-		w.Header().Set("Cache-Control", hh.hfs.getCacheControl())
-		w.Header().Set("ETag", hash)
+	if hh.hfs.devMode {
+		//In development mode, always make the browser revalidate. The Etag is
+		//calculated from the file's current contents so unchanged files don't
+		//need to be downloaded again.
+		content, err := io.ReadAll(f)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		f.Close()
+		f = newMemFile(content, info)
+
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", entityTag(hh.hfs.calculateHash(content), ""))
+	} else if hash := rev.hash; hash != "" {
+		//Serve a precompressed version of the file, if one exists and the browser
+		//accepts the encoding. The Etag is modified per-encoding since the bytes
+		//served differ.
+		//
+		//If no precompressed version exists, compress the file on-the-fly, if
+		//enabled.
+		//
+		//Precompressed versions of files with rewritten contents are not used
+		//since they would not include the rewritten references.
+		encoding := ""
+		originalPath := rev.originalPath
+
+		var (
+			pf    fs.File
+			pinfo fs.FileInfo
+		)
+		if rev.content == nil {
+			pf, pinfo, encoding = hh.hfs.openPrecompressed(w, r, originalPath)
+		}
+
+		if pf != nil {
+			f.Close()
+			f, info = pf, pinfo
+		} else if cf, cinfo, cencoding, err := hh.hfs.compressed(w, r, hashPath, originalPath, f, info); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		} else if cf != nil {
+			f.Close()
+			f, info = cf, cinfo
+			encoding = cencoding
+		}
+
+		if stale {
+			w.Header().Set("Cache-Control", queryStringCacheControl())
+		} else {
+			w.Header().Set("Cache-Control", hh.hfs.getCacheControl())
+		}
+		w.Header().Set("ETag", entityTag(hash, encoding))
 
 		//We don't set a Last-Modified header since the file info available for
 		//files in an fs.FS does not include when the file was modified. Instead,
@@ -512,14 +1208,28 @@ func (hh *hfsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	//Write out the file's contents.
+	//
+	//The Content-Type is based on the original path's extension since a filename
+	//pattern may put the hash after the extension, i.e. app.js.a1b2c3d4.
+	name := filePath
+	if rev.hash != "" {
+		name = rev.originalPath
+	}
+
 	switch f := f.(type) {
 	case io.ReadSeeker:
-		http.ServeContent(w, r, filePath, info.ModTime(), f)
+		http.ServeContent(w, r, name, info.ModTime(), f)
 	default:
+		//Handle conditional requests since http.ServeContent can't be used. Range
+		//requests aren't supported since the file can't be seeked, so If-Range is
+		//ignored and the full file is always served.
+		if checkPreconditions(w, r) {
+			return
+		}
+
 		//Only write out file's data on non-HEAD requests.
-		//TODO: not sure how to test this "default" case.
-		w.WriteHeader(http.StatusOK)
 		w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+		w.WriteHeader(http.StatusOK)
 
 		if r.Method != "HEAD" {
 			io.Copy(w, f)
@@ -3,12 +3,20 @@ package hashfs
 import (
 	"crypto"
 	"embed"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"hash/crc64"
+	"hash/fnv"
+	"html/template"
 	"io"
 	"io/fs"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 )
 
@@ -321,7 +329,7 @@ func TestFileServer(t *testing.T) {
 
 		got = res.Header.Get("Etag")
 		rev := hfs.hashPathReverse[hashPath]
-		want = rev.hash
+		want = `"` + rev.hash + `"`
 		if got != want {
 			t.Fatalf("bad etag; \ngot:  %s, \nwant: %s", string(got), want)
 			return
@@ -409,7 +417,7 @@ func TestCalculateHash(t *testing.T) {
 			}
 		}()
 
-		_ = NewFS(fsys, HashAlgo(crypto.SHA1))
+		_ = NewFS(fsys, HashAlgo(crypto.SHA3_256))
 	})
 
 	t.Run("SHA256", func(t *testing.T) {
@@ -447,6 +455,69 @@ func TestCalculateHash(t *testing.T) {
 	})
 }
 
+func TestHasher(t *testing.T) {
+	fileContents, err := fs.ReadFile(fsys, "testdata/subdir1/script.js")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	t.Run("HashAlgo", func(t *testing.T) {
+		//Generated via PC terminal, not golang.
+		tests := map[crypto.Hash]string{
+			crypto.SHA1:       "6e4ea38fc00788c708cc56c8cbfb6e57e6b50d89",
+			crypto.SHA512:     "2e2f640fe5e9f9ce733e050c68d91042032b61fa0e0d496a7e2d97e0b5d037d59415dff4ba7eb508caa3d166c17654654b01f36f89bf00c5db758cb4743977c5",
+			crypto.SHA512_256: "cd978e4b14ae4d16342021a37070906c1cf0430b699bf2c122c0c64e5d45d495",
+		}
+
+		for algo, want := range tests {
+			hfs := NewFS(fsys, HashAlgo(algo))
+			got := hfs.calculateHash(fileContents)
+			if got != want {
+				t.Fatalf("bad hash for %s; \ngot:  %s, \nwant: %s", algo, got, want)
+				return
+			}
+		}
+	})
+
+	t.Run("NonCryptographic", func(t *testing.T) {
+		tests := map[Hasher]hash.Hash{
+			HasherFNV1a64:  fnv.New64a(),
+			HasherFNV1a128: fnv.New128a(),
+			HasherCRC64:    crc64.New(crc64.MakeTable(crc64.ECMA)),
+		}
+
+		for hasher, h := range tests {
+			h.Write(fileContents)
+			want := hex.EncodeToString(h.Sum(nil))
+
+			hfs := NewFS(fsys, HashWith(hasher))
+			got := hfs.calculateHash(fileContents)
+			if got != want {
+				t.Fatalf("bad hash for %s; \ngot:  %s, \nwant: %s", hasher.Name(), got, want)
+				return
+			}
+
+			//Hash paths must still be resolvable.
+			hashPath := hfs.GetHashPath("testdata/subdir1/script.js")
+			if rev, ok := hfs.resolveHashPath(hashPath); !ok || rev.hash != want {
+				t.Fatal("could not resolve hash path", hashPath)
+				return
+			}
+		}
+	})
+
+	t.Run("Nil", func(t *testing.T) {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatal("panic should have occured for nil hasher")
+			}
+		}()
+
+		_ = NewFS(fsys, HashWith(nil))
+	})
+}
+
 func TestMaxAge(t *testing.T) {
 	t.Run("Default", func(t *testing.T) {
 		hfs := NewFS(fsys)
@@ -568,3 +639,443 @@ func TestHashLength(t *testing.T) {
 		}
 	})
 }
+
+// errFS is an fs.FS that returns an error when a specific file is opened. This is
+// used to test handling of errors when reading files.
+type errFS struct {
+	fs.FS
+	badPath string
+}
+
+func (e errFS) Open(name string) (fs.File, error) {
+	if name == e.badPath {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+
+	return e.FS.Open(name)
+}
+
+func TestHashAll(t *testing.T) {
+	t.Run("AllFiles", func(t *testing.T) {
+		hfs := NewFS(fsys)
+		err := hfs.HashAll()
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		want := map[string]string{
+			"testdata/subdir1/script.js":      "testdata/subdir1/script.js-" + scriptjs + ".js",
+			"testdata/subdir1/styles.min.css": "testdata/subdir1/styles.min.css-" + stylesmincss + ".css",
+			"testdata/subdir1/indexhtml":      "testdata/subdir1/indexhtml-" + indexhtml,
+			"testdata/sub.dir.2/text.txt":     "testdata/sub.dir.2/text.txt-" + texttxt + ".txt",
+		}
+		for originalPath, wantPath := range want {
+			got, exists := hfs.originalPathToHashPath[originalPath]
+			if !exists {
+				t.Fatal("file not hashed", originalPath)
+				return
+			}
+			if got != wantPath {
+				t.Fatalf("bad hash path; \ngot:  %s, \nwant: %s", got, wantPath)
+				return
+			}
+
+			rev, exists := hfs.hashPathReverse[wantPath]
+			if !exists || rev.originalPath != originalPath {
+				t.Fatal("reverse lookup not stored", wantPath)
+				return
+			}
+		}
+	})
+
+	t.Run("Precompute", func(t *testing.T) {
+		hfs := NewFS(fsys, Precompute())
+
+		originalPath := "testdata/sub.dir.2/text.txt"
+		hashPath := "testdata/sub.dir.2/text.txt-" + texttxt + ".txt"
+		if _, exists := hfs.hashPathReverse[hashPath]; !exists {
+			t.Fatal("file not hashed when NewFS was called", originalPath)
+			return
+		}
+
+		//Hash path should be servable without GetHashPath having been called.
+		r := httptest.NewRequest("GET", "/"+hashPath, nil)
+		w := httptest.NewRecorder()
+		s := FileServer(hfs)
+		s.ServeHTTP(w, r)
+
+		res := w.Result()
+		if res.StatusCode != http.StatusOK {
+			t.Fatal("bad code", res.StatusCode)
+			return
+		}
+		if res.Header.Get("Cache-Control") != hfs.getCacheControl() {
+			t.Fatal("caching headers not set for precomputed hash path")
+			return
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		badPath := "testdata/subdir1/script.js"
+		hfs := NewFS(errFS{fsys, badPath})
+
+		err := hfs.HashAll()
+		if !errors.Is(err, fs.ErrPermission) {
+			t.Fatal("expected error for unreadable file", err)
+			return
+		}
+
+		//Other files should still be hashed.
+		if _, exists := hfs.originalPathToHashPath["testdata/sub.dir.2/text.txt"]; !exists {
+			t.Fatal("readable file not hashed")
+			return
+		}
+		if _, exists := hfs.originalPathToHashPath[badPath]; exists {
+			t.Fatal("unreadable file should not have been hashed")
+			return
+		}
+	})
+}
+
+func TestGetHashPathE(t *testing.T) {
+	t.Run("Exists", func(t *testing.T) {
+		hfs := NewFS(fsys)
+
+		originalPath := "testdata/subdir1/script.js"
+		expectedPath := "testdata/subdir1/script.js-" + scriptjs + ".js"
+		hashPath, err := hfs.GetHashPathE(originalPath)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if hashPath != expectedPath {
+			t.Fatal("hash not added to filename correctly", hashPath)
+			return
+		}
+	})
+
+	t.Run("NotExist", func(t *testing.T) {
+		hfs := NewFS(fsys)
+
+		originalPath := "testdata/subdir1/stlyes.css"
+		hashPath, err := hfs.GetHashPathE(originalPath)
+		if !errors.Is(err, ErrNotExist) {
+			t.Fatal("expected ErrNotExist", err)
+			return
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Fatal("expected error to also match fs.ErrNotExist", err)
+			return
+		}
+		if !strings.Contains(err.Error(), originalPath) {
+			t.Fatal("error should include path", err)
+			return
+		}
+		if hashPath != "" {
+			t.Fatal("hash path should be blank on error", hashPath)
+			return
+		}
+	})
+
+	t.Run("IsDir", func(t *testing.T) {
+		hfs := NewFS(fsys)
+
+		_, err := hfs.GetHashPathE("testdata/subdir1")
+		if !errors.Is(err, ErrIsDir) {
+			t.Fatal("expected ErrIsDir", err)
+			return
+		}
+	})
+
+	t.Run("HashCollision", func(t *testing.T) {
+		hfs := NewFS(fsys)
+
+		//Fake another file already using the hash path.
+		originalPath := "testdata/subdir1/script.js"
+		expectedPath := "testdata/subdir1/script.js-" + scriptjs + ".js"
+		hfs.hashPathReverse[expectedPath] = reverse{originalPath: "testdata/other.js", hash: scriptjs}
+
+		_, err := hfs.GetHashPathE(originalPath)
+		if !errors.Is(err, ErrHashCollision) {
+			t.Fatal("expected ErrHashCollision", err)
+			return
+		}
+
+		//GetHashPath should still fall back to the original path.
+		hashPath := hfs.GetHashPath(originalPath)
+		if hashPath != originalPath {
+			t.Fatal("expected original path on error", hashPath)
+			return
+		}
+	})
+
+	t.Run("Template", func(t *testing.T) {
+		hfs := NewFS(fsys)
+
+		funcMap := template.FuncMap{
+			"static": hfs.GetHashPathE,
+		}
+		tmpl := template.Must(template.New("").Funcs(funcMap).Parse(`<script src='{{static "testdata/subdir1/scirpt.js"}}'></script>`))
+
+		err := tmpl.Execute(io.Discard, nil)
+		if !errors.Is(err, ErrNotExist) {
+			t.Fatal("expected template to fail to execute", err)
+			return
+		}
+	})
+}
+
+func TestURLPrefix(t *testing.T) {
+	t.Run("Normalize", func(t *testing.T) {
+		for _, prefix := range []string{"/static/", "static", "/static", "static/"} {
+			hfs := NewFS(fsys, URLPrefix(prefix))
+			if hfs.urlPrefix != "/static/" {
+				t.Fatalf("bad prefix; \ngot:  %s, \nwant: %s", hfs.urlPrefix, "/static/")
+				return
+			}
+		}
+	})
+
+	hfs := NewFS(fsys, URLPrefix("/static/"))
+	originalPath := "/static/testdata/subdir1/script.js"
+	expectedPath := "/static/testdata/subdir1/script.js-" + scriptjs + ".js"
+
+	t.Run("GetHashPath", func(t *testing.T) {
+		hashPath, err := hfs.GetHashPathE(originalPath)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if hashPath != expectedPath {
+			t.Fatalf("bad hash path; \ngot:  %s, \nwant: %s", hashPath, expectedPath)
+			return
+		}
+
+		//Paths without the prefix are looked up in the fs.FS as-is.
+		hashPath = hfs.GetHashPath("testdata/subdir1/script.js")
+		if hashPath != expectedPath {
+			t.Fatalf("bad hash path; \ngot:  %s, \nwant: %s", hashPath, expectedPath)
+			return
+		}
+
+		//Lookup tables still use paths in the fs.FS.
+		if _, ok := hfs.hashPathReverse[strings.TrimPrefix(expectedPath, "/static/")]; !ok {
+			t.Fatal("expected lookup table to use fs.FS path")
+			return
+		}
+	})
+
+	t.Run("Integrity", func(t *testing.T) {
+		got := hfs.Integrity(originalPath)
+		want := NewFS(fsys).Integrity("testdata/subdir1/script.js")
+		if got != want {
+			t.Fatalf("bad integrity; \ngot:  %s, \nwant: %s", got, want)
+			return
+		}
+	})
+
+	t.Run("FileServer", func(t *testing.T) {
+		r := httptest.NewRequest("GET", expectedPath, nil)
+		w := httptest.NewRecorder()
+		FileServer(hfs).ServeHTTP(w, r)
+
+		res := w.Result()
+		if res.StatusCode != http.StatusOK {
+			t.Fatal("bad code", res.StatusCode)
+			return
+		}
+		if res.Header.Get("Cache-Control") == "" {
+			t.Fatal("expected cache-control header for hash path")
+			return
+		}
+	})
+
+	t.Run("FileServerOutsidePrefix", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/testdata/subdir1/script.js", nil)
+		w := httptest.NewRecorder()
+		FileServer(hfs).ServeHTTP(w, r)
+
+		res := w.Result()
+		if res.StatusCode != http.StatusNotFound {
+			t.Fatal("bad code", res.StatusCode)
+			return
+		}
+	})
+
+	t.Run("FuncMap", func(t *testing.T) {
+		static := hfs.FuncMap(FuncMapOptions{})["static"].(func(string) (string, error))
+		got, err := static(originalPath)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if got != expectedPath {
+			t.Fatalf("bad static path; \ngot:  %s, \nwant: %s", got, expectedPath)
+			return
+		}
+	})
+}
+
+func TestDevMode(t *testing.T) {
+	mfs := fstest.MapFS{
+		"css/styles.css": {Data: []byte(`body { color: pink; }`)},
+	}
+	hfs := NewFS(mfs, DevMode(), Precompute())
+
+	t.Run("GetHashPath", func(t *testing.T) {
+		originalPath := "css/styles.css"
+		hashPath, err := hfs.GetHashPathE(originalPath)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if hashPath != originalPath {
+			t.Fatalf("bad hash path; \ngot:  %s, \nwant: %s", hashPath, originalPath)
+			return
+		}
+		if len(hfs.originalPathToHashPath) != 0 || len(hfs.hashPathReverse) != 0 {
+			t.Fatal("lookup tables should not be populated in dev mode")
+			return
+		}
+
+		_, err = hfs.GetHashPathE("css/missing.css")
+		if !errors.Is(err, ErrNotExist) {
+			t.Fatal("expected ErrNotExist", err)
+			return
+		}
+	})
+
+	t.Run("FileServer", func(t *testing.T) {
+		serve := func() *http.Response {
+			r := httptest.NewRequest("GET", "/css/styles.css", nil)
+			w := httptest.NewRecorder()
+			FileServer(hfs).ServeHTTP(w, r)
+			return w.Result()
+		}
+
+		res := serve()
+		if res.StatusCode != http.StatusOK {
+			t.Fatal("bad code", res.StatusCode)
+			return
+		}
+		if got := res.Header.Get("Cache-Control"); got != "no-cache" {
+			t.Fatalf("bad cache-control; \ngot:  %s, \nwant: %s", got, "no-cache")
+			return
+		}
+		etag := res.Header.Get("ETag")
+		if want := `"` + hfs.calculateHash([]byte(`body { color: pink; }`)) + `"`; etag != want {
+			t.Fatalf("bad etag; \ngot:  %s, \nwant: %s", etag, want)
+			return
+		}
+
+		//Changes to the file should be picked up immediately.
+		mfs["css/styles.css"] = &fstest.MapFile{Data: []byte(`body { color: blue; }`)}
+		res = serve()
+		body, _ := io.ReadAll(res.Body)
+		if string(body) != `body { color: blue; }` {
+			t.Fatalf("bad content; \ngot:  %s, \nwant: %s", body, `body { color: blue; }`)
+			return
+		}
+		if res.Header.Get("ETag") == etag {
+			t.Fatal("etag should change when contents change")
+			return
+		}
+	})
+
+	t.Run("Integrity", func(t *testing.T) {
+		got := hfs.Integrity("css/styles.css")
+		want := hfs.calculateIntegrity([]byte(`body { color: blue; }`))
+		if got != want {
+			t.Fatalf("bad integrity; \ngot:  %s, \nwant: %s", got, want)
+			return
+		}
+	})
+}
+
+func TestParseHashPath(t *testing.T) {
+	locations := map[string]optionFunc{
+		"Start":       HashLocationStart(),
+		"FirstPeriod": HashLocationFirstPeriod(),
+		"End":         HashLocationEnd(),
+	}
+	originalPaths := []string{
+		"testdata/subdir1/script.js",
+		"testdata/subdir1/styles.min.css",
+		"testdata/subdir1/indexhtml",
+		"testdata/sub.dir.2/text.txt",
+	}
+
+	for name, location := range locations {
+		t.Run(name, func(t *testing.T) {
+			hfs := NewFS(fsys, location)
+
+			for _, originalPath := range originalPaths {
+				hash := hfs.calculateHash([]byte(originalPath))
+				hashPath := hfs.buildHashPath(originalPath, hash)
+
+				gotPath, gotHash, ok := hfs.parseHashPath(hashPath)
+				if !ok {
+					t.Fatal("could not parse hash path", hashPath)
+					return
+				}
+				if gotPath != originalPath {
+					t.Fatalf("bad original path; \ngot:  %s, \nwant: %s", gotPath, originalPath)
+					return
+				}
+				if gotHash != hash {
+					t.Fatalf("bad hash; \ngot:  %s, \nwant: %s", gotHash, hash)
+					return
+				}
+			}
+
+			//Original paths are not hash paths.
+			for _, originalPath := range originalPaths {
+				if _, _, ok := hfs.parseHashPath(originalPath); ok {
+					t.Fatal("original path parsed as hash path", originalPath)
+					return
+				}
+			}
+		})
+	}
+}
+
+func TestResolveHashPath(t *testing.T) {
+	//Get a hash path as if it was rendered by another replica.
+	originalPath := "testdata/subdir1/script.js"
+	hashPath := NewFS(fsys, HashLength(16)).GetHashPath(originalPath)
+
+	get := func(hfs *HFS, p string) *http.Response {
+		r := httptest.NewRequest("GET", "/"+p, nil)
+		w := httptest.NewRecorder()
+		FileServer(hfs).ServeHTTP(w, r)
+		return w.Result()
+	}
+
+	t.Run("Match", func(t *testing.T) {
+		hfs := NewFS(fsys, HashLength(16))
+		res := get(hfs, hashPath)
+		if res.StatusCode != http.StatusOK {
+			t.Fatal("bad code", res.StatusCode)
+			return
+		}
+		if got := res.Header.Get("Cache-Control"); got != hfs.getCacheControl() {
+			t.Fatalf("bad cache-control; \ngot:  %s, \nwant: %s", got, hfs.getCacheControl())
+			return
+		}
+		if _, exists := hfs.hashPathReverse[hashPath]; !exists {
+			t.Fatal("resolved hash path not stored")
+			return
+		}
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		hfs := NewFS(fsys, HashLength(16))
+		stale := strings.Replace(hashPath, scriptjs[:16], "0123456789abcdef", 1)
+		res := get(hfs, stale)
+		if res.StatusCode != http.StatusNotFound {
+			t.Fatal("bad code", res.StatusCode)
+			return
+		}
+	})
+}
@@ -0,0 +1,554 @@
+package hashfs
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// rewriteAttributes are the HTML attributes whose values are rewritten by
+// HTMLMiddleware. srcset is handled separately since it holds a list of URLs.
+var rewriteAttributes = map[string]bool{
+	"src":    true,
+	"href":   true,
+	"srcset": true,
+	"poster": true,
+}
+
+// sniffLen is the amount of data needed to sniff the Content-Type of a response.
+// This matches what http.DetectContentType uses.
+const sniffLen = 512
+
+// rawTextElements are the HTML elements whose contents are not parsed as HTML, i.e.
+// a "<" inside a <script> is not the start of a tag.
+var rawTextElements = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"textarea": true,
+	"title":    true,
+	"xmp":      true,
+	"iframe":   true,
+	"noembed":  true,
+	"noframes": true,
+}
+
+// HTMLMiddleware returns middleware that rewrites the URLs to static files in HTML
+// responses to their hash paths. This removes the need to call GetHashPath, via a
+// template func, for every static file in your HTML templates and works with HTML
+// generated by other libraries.
+//
+// Responses with a Content-Type of text/html are streamed through a tokenizer and
+// the src, href, srcset, and poster attributes of each tag are rewritten if the URL
+// starts with staticPrefix. The staticPrefix is removed before calling GetHashPath
+// and added back to the returned hash path. For example, with a staticPrefix of
+// "/static/", <script src="/static/js/script.js"> becomes
+// <script src="/static/js/script.js-a1b2c3...d4e5f6.js">. URLs to files that cannot
+// be hashed are left as-is.
+//
+// The staticPrefix is normalized to start and end with a slash, so "/static" and
+// "/static/" are the same and neither matches /staticx/. If staticPrefix is blank,
+// the URLPrefix option provided to NewFS is used. If that
+// is also blank, "/" is used, meaning files are served from the root of your site,
+// so only absolute URLs are rewritten. Relative URLs are never rewritten since they
+// are resolved from the page's URL, not from the root of the fs.FS.
+//
+// All other responses, and responses that are already compressed, pass through
+// untouched.
+//
+// A minimal tokenizer is used, rather than a full HTML parser, to keep hashfs free
+// of dependencies and to allow responses to be streamed.
+func HTMLMiddleware(hfs *HFS, staticPrefix string) func(http.Handler) http.Handler {
+	//A blank prefix becomes "/" once normalized.
+	if staticPrefix == "" {
+		staticPrefix = hfs.urlPrefix
+	}
+	staticPrefix = normalizePrefix(staticPrefix)
+
+	rewrite := func(url string) string {
+		//Separate any query string or fragment.
+		urlPath, suffix := url, ""
+		if i := strings.IndexAny(url, "?#"); i != -1 {
+			urlPath, suffix = url[:i], url[i:]
+		}
+
+		//Protocol-relative URLs point to other hosts.
+		if strings.HasPrefix(urlPath, "//") {
+			return url
+		}
+
+		trimmedPath, found := strings.CutPrefix(urlPath, staticPrefix)
+		if !found || trimmedPath == "" {
+			return url
+		}
+
+		hashPath, err := hfs.getHashPath(trimmedPath, nil)
+		if err != nil {
+			return url
+		}
+
+		return joinQuery(staticPrefix+hashPath, suffix, "&")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hw := &htmlResponseWriter{ResponseWriter: w, rewrite: rewrite}
+			defer hw.close()
+
+			next.ServeHTTP(hw, r)
+		})
+	}
+}
+
+// htmlResponseWriter is an http.ResponseWriter that rewrites HTML responses.
+type htmlResponseWriter struct {
+	http.ResponseWriter
+	rewrite func(url string) string
+
+	decided       bool //if we have determined whether or not the response is HTML.
+	isHTML        bool
+	wroteHeader   bool
+	pendingStatus int    //status code to send once we know if the response is HTML.
+	sniff         []byte //data buffered until the Content-Type can be sniffed.
+	tokenizer     *htmlTokenizer
+}
+
+// decide determines whether or not the response is HTML that should be rewritten.
+// If the Content-Type header has not been set, it is sniffed from b, the same as
+// http.ResponseWriter would.
+func (hw *htmlResponseWriter) decide(b []byte) {
+	if hw.decided {
+		return
+	}
+	hw.decided = true
+
+	h := hw.Header()
+	contentType := h.Get("Content-Type")
+	if contentType == "" && len(b) > 0 {
+		contentType = http.DetectContentType(b)
+		h.Set("Content-Type", contentType)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "text/html" || h.Get("Content-Encoding") != "" {
+		return
+	}
+
+	hw.isHTML = true
+	hw.tokenizer = &htmlTokenizer{w: hw.ResponseWriter, rewrite: hw.rewrite}
+
+	//The length of the response will change.
+	h.Del("Content-Length")
+}
+
+// WriteHeader stores the status code to be sent. If the Content-Type is known, the
+// status code is sent now. Otherwise, the status code is sent once the body is
+// written and the Content-Type can be sniffed, since headers cannot be modified
+// after the status code is sent.
+func (hw *htmlResponseWriter) WriteHeader(code int) {
+	if hw.wroteHeader {
+		return
+	}
+	hw.wroteHeader = true
+	hw.pendingStatus = code
+
+	if hw.Header().Get("Content-Type") != "" {
+		hw.decide(nil)
+		hw.sendStatus()
+	}
+}
+
+// sendStatus sends the pending status code, if any.
+func (hw *htmlResponseWriter) sendStatus() {
+	if hw.pendingStatus == 0 {
+		return
+	}
+
+	hw.ResponseWriter.WriteHeader(hw.pendingStatus)
+	hw.pendingStatus = 0
+}
+
+// Write writes b to the response, rewriting it if the response is HTML.
+//
+// If the Content-Type has not been set, data is buffered until enough has been
+// written to sniff the Content-Type, the same as http.ResponseWriter does.
+func (hw *htmlResponseWriter) Write(b []byte) (int, error) {
+	if !hw.wroteHeader {
+		hw.WriteHeader(http.StatusOK)
+	}
+
+	if !hw.decided {
+		hw.sniff = append(hw.sniff, b...)
+		if len(hw.sniff) < sniffLen {
+			return len(b), nil
+		}
+
+		err := hw.writeSniffed()
+		if err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	return len(b), hw.write(b)
+}
+
+// writeSniffed decides whether or not the response is HTML based on the buffered
+// data and writes the buffered data.
+func (hw *htmlResponseWriter) writeSniffed() error {
+	hw.decide(hw.sniff)
+	b := hw.sniff
+	hw.sniff = nil
+
+	return hw.write(b)
+}
+
+// write writes b to the response, rewriting it if the response is HTML. The status
+// code is sent first, if needed.
+func (hw *htmlResponseWriter) write(b []byte) (err error) {
+	hw.sendStatus()
+
+	if !hw.isHTML {
+		_, err = hw.ResponseWriter.Write(b)
+		return
+	}
+
+	return hw.tokenizer.write(b, false)
+}
+
+// Flush writes any buffered data to the client, if the underlying ResponseWriter
+// supports flushing. Data that is part of an incomplete tag is not flushed.
+func (hw *htmlResponseWriter) Flush() {
+	if !hw.decided && hw.wroteHeader {
+		hw.writeSniffed()
+	}
+	hw.sendStatus()
+
+	if f, ok := hw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter for use with http.ResponseController.
+func (hw *htmlResponseWriter) Unwrap() http.ResponseWriter {
+	return hw.ResponseWriter
+}
+
+// close writes any data buffered for sniffing, sends the status code if it hasn't
+// been sent because nothing was written, and writes any remaining buffered data.
+func (hw *htmlResponseWriter) close() {
+	if !hw.decided && len(hw.sniff) > 0 {
+		hw.writeSniffed()
+	}
+	hw.sendStatus()
+
+	if hw.isHTML {
+		hw.tokenizer.write(nil, true)
+	}
+}
+
+// htmlTokenizer is a minimal streaming HTML tokenizer that rewrites URL attributes
+// in start tags. Everything else is written out unmodified.
+//
+// Data is buffered only while an incomplete tag, comment, or raw text end tag is
+// being received.
+type htmlTokenizer struct {
+	w       io.Writer
+	rewrite func(url string) string
+
+	pending []byte
+	rawTag  string //set when inside a raw text element, i.e. <script>.
+}
+
+// write processes b, writing out everything that is complete. If final is true, no
+// more data will be received so anything incomplete is written out as-is.
+func (t *htmlTokenizer) write(b []byte, final bool) (err error) {
+	t.pending = append(t.pending, b...)
+	p := t.pending
+
+	var out bytes.Buffer
+	for len(p) > 0 {
+		n, done := t.next(p, &out)
+		if !done {
+			break
+		}
+		p = p[n:]
+	}
+
+	if final {
+		out.Write(p)
+		p = nil
+	}
+
+	//Keep whatever was not processed for the next write. A copy is made so the
+	//pending buffer doesn't grow forever.
+	t.pending = append([]byte(nil), p...)
+
+	if out.Len() > 0 {
+		_, err = t.w.Write(out.Bytes())
+	}
+	return
+}
+
+// next processes the next token in p, writing it to out. The number of bytes
+// processed is returned. If the token is incomplete, done is false and nothing is
+// written.
+func (t *htmlTokenizer) next(p []byte, out *bytes.Buffer) (n int, done bool) {
+	//Inside a raw text element, look for the matching end tag.
+	if t.rawTag != "" {
+		return t.nextRawText(p, out)
+	}
+
+	//Write out text up to the next tag.
+	i := bytes.IndexByte(p, '<')
+	if i == -1 {
+		out.Write(p)
+		return len(p), true
+	} else if i > 0 {
+		out.Write(p[:i])
+		return i, true
+	}
+
+	//Figure out what kind of tag this is. Wait for more data if needed.
+	if len(p) < 2 || (p[1] == '!' && len(p) < 4) {
+		return 0, false
+	}
+
+	var end int
+	switch {
+	case bytes.HasPrefix(p, []byte("<!--")):
+		end = bytes.Index(p[4:], []byte("-->"))
+		if end == -1 {
+			return 0, false
+		}
+		end += 4 + 3
+
+	case p[1] == '/' || p[1] == '!' || p[1] == '?':
+		end = bytes.IndexByte(p, '>')
+		if end == -1 {
+			return 0, false
+		}
+		end++
+
+	case isASCIILetter(p[1]):
+		end = tagEnd(p)
+		if end == -1 {
+			return 0, false
+		}
+		out.Write(t.rewriteTag(p[:end]))
+		return end, true
+
+	default:
+		//Just a literal "<".
+		end = 1
+	}
+
+	out.Write(p[:end])
+	return end, true
+}
+
+// nextRawText processes text inside a raw text element, up to the element's end tag.
+func (t *htmlTokenizer) nextRawText(p []byte, out *bytes.Buffer) (n int, done bool) {
+	for i := 0; i < len(p); i++ {
+		if p[i] != '<' {
+			continue
+		}
+
+		//Make sure we have enough data to check for the end tag.
+		endTag := p[i:]
+		if len(endTag) < 2+len(t.rawTag)+1 {
+			if i > 0 {
+				out.Write(p[:i])
+				return i, true
+			}
+			return 0, false
+		}
+
+		if endTag[1] == '/' && strings.EqualFold(string(endTag[2:2+len(t.rawTag)]), t.rawTag) {
+			c := endTag[2+len(t.rawTag)]
+			if c == '>' || c == '/' || isHTMLSpace(c) {
+				t.rawTag = ""
+				out.Write(p[:i])
+				return i, true
+			}
+		}
+	}
+
+	out.Write(p)
+	return len(p), true
+}
+
+// rewriteTag rewrites the URL attributes in a start tag. If the tag starts a raw
+// text element, the tokenizer's state is updated.
+func (t *htmlTokenizer) rewriteTag(tag []byte) []byte {
+	//Get the tag name.
+	i := 1
+	for i < len(tag) && !isHTMLSpace(tag[i]) && tag[i] != '/' && tag[i] != '>' {
+		i++
+	}
+	name := strings.ToLower(string(tag[1:i]))
+	if rawTextElements[name] {
+		t.rawTag = name
+	}
+
+	//Parse each attribute and rewrite values as needed.
+	var (
+		out  bytes.Buffer
+		last int
+	)
+	for i < len(tag) {
+		//Skip to the start of the attribute name.
+		for i < len(tag) && (isHTMLSpace(tag[i]) || tag[i] == '/') {
+			i++
+		}
+		if i >= len(tag) || tag[i] == '>' {
+			break
+		}
+
+		//Get the attribute name.
+		nameStart := i
+		for i < len(tag) && !isHTMLSpace(tag[i]) && tag[i] != '=' && tag[i] != '>' && tag[i] != '/' {
+			i++
+		}
+		attr := strings.ToLower(string(tag[nameStart:i]))
+
+		//Get the value, if any.
+		j := i
+		for j < len(tag) && isHTMLSpace(tag[j]) {
+			j++
+		}
+		if j >= len(tag) || tag[j] != '=' {
+			continue
+		}
+		j++
+		for j < len(tag) && isHTMLSpace(tag[j]) {
+			j++
+		}
+		if j >= len(tag) {
+			break
+		}
+
+		var valueStart, valueEnd int
+		if q := tag[j]; q == '"' || q == '\'' {
+			valueStart = j + 1
+			k := bytes.IndexByte(tag[valueStart:], q)
+			if k == -1 {
+				break
+			}
+			valueEnd = valueStart + k
+			i = valueEnd + 1
+		} else {
+			valueStart = j
+			valueEnd = j
+			for valueEnd < len(tag) && !isHTMLSpace(tag[valueEnd]) && tag[valueEnd] != '>' {
+				valueEnd++
+			}
+			i = valueEnd
+		}
+
+		if !rewriteAttributes[attr] {
+			continue
+		}
+
+		value := string(tag[valueStart:valueEnd])
+		var rewritten string
+		if attr == "srcset" {
+			rewritten = t.rewriteSrcset(value)
+		} else {
+			rewritten = t.rewriteValue(value)
+		}
+
+		out.Write(tag[last:valueStart])
+		out.WriteString(rewritten)
+		last = valueEnd
+	}
+
+	if last == 0 {
+		return tag
+	}
+
+	out.Write(tag[last:])
+	return out.Bytes()
+}
+
+// rewriteValue rewrites a single URL attribute value. The value is HTML escaped, so
+// it is unescaped before being rewritten and the rewritten path is escaped. Any
+// query string or fragment is kept as-is.
+func (t *htmlTokenizer) rewriteValue(value string) string {
+	urlPath, suffix := value, ""
+	if i := strings.IndexAny(value, "?#"); i != -1 {
+		urlPath, suffix = value[:i], value[i:]
+	}
+
+	unescaped := html.UnescapeString(urlPath)
+	rewritten := t.rewrite(unescaped)
+	if rewritten == unescaped {
+		return value
+	}
+
+	//The query strings are combined with an escaped ampersand since the value is
+	//HTML escaped.
+	return joinQuery(html.EscapeString(rewritten), suffix, "&amp;")
+}
+
+// rewriteSrcset rewrites each URL in a srcset attribute value. A srcset is a comma
+// separated list of URLs, each optionally followed by a descriptor.
+func (t *htmlTokenizer) rewriteSrcset(value string) string {
+	candidates := strings.Split(value, ",")
+	for i, c := range candidates {
+		//Find the URL, keeping any surrounding whitespace and descriptor.
+		start := 0
+		for start < len(c) && isHTMLSpace(c[start]) {
+			start++
+		}
+		end := start
+		for end < len(c) && !isHTMLSpace(c[end]) {
+			end++
+		}
+
+		candidates[i] = c[:start] + t.rewriteValue(c[start:end]) + c[end:]
+	}
+
+	return strings.Join(candidates, ",")
+}
+
+// tagEnd returns the index just past the ">" that ends the tag at the start of p,
+// ignoring any ">" in quoted attribute values. -1 is returned if the tag is
+// incomplete.
+func tagEnd(p []byte) int {
+	var quote byte
+	for i := 1; i < len(p); i++ {
+		switch c := p[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			//Quotes only start a value directly after an "=", possibly with
+			//whitespace in between.
+			j := i - 1
+			for j > 0 && isHTMLSpace(p[j]) {
+				j--
+			}
+			if p[j] == '=' {
+				quote = c
+			}
+		case c == '>':
+			return i + 1
+		}
+	}
+
+	return -1
+}
+
+// isHTMLSpace returns true if c is whitespace, as defined by the HTML spec.
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+}
+
+// isASCIILetter returns true if c is an ASCII letter.
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
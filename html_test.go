@@ -0,0 +1,181 @@
+package hashfs
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"testing/fstest"
+)
+
+func TestHTMLMiddleware(t *testing.T) {
+	mfs := fstest.MapFS{
+		"css/styles.css": {Data: []byte("body {}")},
+		"js/script.js":   {Data: []byte("console.log(1);")},
+		"img/a.png":      {Data: []byte("a")},
+		"img/b.png":      {Data: []byte("b")},
+		"video/v.mp4":    {Data: []byte("v")},
+	}
+	hfs := NewFS(mfs, HashLength(8))
+
+	styles := "/static/" + hfs.GetHashPath("css/styles.css")
+	script := "/static/" + hfs.GetHashPath("js/script.js")
+	a := "/static/" + hfs.GetHashPath("img/a.png")
+	b := "/static/" + hfs.GetHashPath("img/b.png")
+	v := "/static/" + hfs.GetHashPath("video/v.mp4")
+
+	page := `<!DOCTYPE html>
+<html>
+<head>
+	<link rel="stylesheet" href="/static/css/styles.css?v=1">
+	<!-- <link href="/static/css/styles.css"> -->
+	<script>if (1 < 2) { document.write('<img src="/static/img/a.png">'); }</script>
+	<SCRIPT SRC='/static/js/script.js' defer></SCRIPT>
+</head>
+<body data-x="a > b" class=main>
+	<img src=/static/img/a.png alt="/static/img/a.png">
+	<img srcset="/static/img/a.png 1x, /static/img/b.png 2x" src="/other/img/a.png">
+	<video poster="/static/img/b.png"><source src="/static/video/v.mp4"></video>
+	<a href="/static/missing.png">missing</a>
+	<a href="https://example.com/static/img/a.png">external</a>
+	<p>1 < 2</p>
+</body>
+</html>`
+
+	want := `<!DOCTYPE html>
+<html>
+<head>
+	<link rel="stylesheet" href="` + styles + `?v=1">
+	<!-- <link href="/static/css/styles.css"> -->
+	<script>if (1 < 2) { document.write('<img src="/static/img/a.png">'); }</script>
+	<SCRIPT SRC='` + script + `' defer></SCRIPT>
+</head>
+<body data-x="a > b" class=main>
+	<img src=` + a + ` alt="/static/img/a.png">
+	<img srcset="` + a + ` 1x, ` + b + ` 2x" src="/other/img/a.png">
+	<video poster="` + b + `"><source src="` + v + `"></video>
+	<a href="/static/missing.png">missing</a>
+	<a href="https://example.com/static/img/a.png">external</a>
+	<p>1 < 2</p>
+</body>
+</html>`
+
+	middleware := HTMLMiddleware(hfs, "/static/")
+
+	t.Run("Rewrite", func(t *testing.T) {
+		h := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("Content-Length", strconv.Itoa(len(page)))
+			io.WriteString(w, page)
+		}))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		res := w.Result()
+		body, _ := io.ReadAll(res.Body)
+		if string(body) != want {
+			t.Fatalf("bad content; \ngot:  %s, \nwant: %s", body, want)
+			return
+		}
+		if res.Header.Get("Content-Length") != "" {
+			t.Fatal("Content-Length should be removed")
+			return
+		}
+	})
+
+	t.Run("Streamed", func(t *testing.T) {
+		//Write one byte at a time, with no Content-Type, to make sure incomplete
+		//tags are handled and the Content-Type is sniffed.
+		h := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for i := 0; i < len(page); i++ {
+				w.Write([]byte{page[i]})
+			}
+		}))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		res := w.Result()
+		body, _ := io.ReadAll(res.Body)
+		if string(body) != want {
+			t.Fatalf("bad content; \ngot:  %s, \nwant: %s", body, want)
+			return
+		}
+	})
+
+	t.Run("NotHTML", func(t *testing.T) {
+		h := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusTeapot)
+			io.WriteString(w, page)
+		}))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		res := w.Result()
+		if res.StatusCode != http.StatusTeapot {
+			t.Fatal("bad code", res.StatusCode)
+			return
+		}
+		body, _ := io.ReadAll(res.Body)
+		if string(body) != page {
+			t.Fatalf("bad content; \ngot:  %s, \nwant: %s", body, page)
+			return
+		}
+	})
+
+	t.Run("PrefixNormalized", func(t *testing.T) {
+		h := HTMLMiddleware(hfs, "/static")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, `<link href="/static/css/styles.css"><img src="/staticx/img/a.png">`)
+		}))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		body, _ := io.ReadAll(w.Result().Body)
+		want := `<link href="` + styles + `"><img src="/staticx/img/a.png">`
+		if string(body) != want {
+			t.Fatalf("bad content; \ngot:  %s, \nwant: %s", body, want)
+			return
+		}
+	})
+
+	t.Run("NoPrefix", func(t *testing.T) {
+		//Files are served from the root of the site, so only absolute URLs are
+		//rewritten. Relative URLs are resolved from the page's URL.
+		h := HTMLMiddleware(hfs, "")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, `<img src="/img/a.png"><img src="img/a.png"><img src="//cdn.example.com/img/a.png">`)
+		}))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/blog/post", nil))
+
+		body, _ := io.ReadAll(w.Result().Body)
+		want := `<img src="/` + hfs.GetHashPath("img/a.png") + `"><img src="img/a.png"><img src="//cdn.example.com/img/a.png">`
+		if string(body) != want {
+			t.Fatalf("bad content; \ngot:  %s, \nwant: %s", body, want)
+			return
+		}
+	})
+
+	t.Run("Incomplete", func(t *testing.T) {
+		h := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, `<p>text</p><img src="/static/img/a.png"`)
+		}))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		body, _ := io.ReadAll(w.Result().Body)
+		if want := `<p>text</p><img src="/static/img/a.png"`; string(body) != want {
+			t.Fatalf("bad content; \ngot:  %s, \nwant: %s", body, want)
+			return
+		}
+	})
+}
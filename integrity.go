@@ -0,0 +1,106 @@
+package hashfs
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+)
+
+// integrityPrefixes are the prefixes used in Subresource Integrity values for each
+// supported algorithm.
+var integrityPrefixes = map[crypto.Hash]string{
+	crypto.SHA256: "sha256-",
+	crypto.SHA384: "sha384-",
+	crypto.SHA512: "sha512-",
+}
+
+// IntegrityAlgo specifies the algorithm to use to calculate the Subresource Integrity
+// value of each file's contents. Default is SHA384. Only SHA256, SHA384, and SHA512
+// are supported, since these are the only algorithms browsers support. This will
+// panic if an unsupported algorithm is provided.
+//
+// This is independent of HashAlgo, which is used for the hash in each filename.
+func IntegrityAlgo(algo crypto.Hash) optionFunc {
+	return func(hfs *HFS) {
+		if _, ok := integrityPrefixes[algo]; !ok {
+			panic("unsupported integrity algorithm used")
+		}
+
+		hfs.integrityAlgo = algo
+	}
+}
+
+// Integrity returns the Subresource Integrity value, i.e. sha384-<base64>, for the
+// file at the provided originalPath. The value is calculated at the same time as the
+// file's hash, if it has not been already, and is cached for future use. A blank
+// value is returned if the file cannot be hashed.
+//
+// Use this for the integrity attribute of <script> and <link> tags.
+//
+// If the URLPrefix option was provided, the originalPath may be a full URL path.
+func (hfs *HFS) Integrity(originalPath string) string {
+	return hfs.integrity(hfs.trimURLPrefix(originalPath))
+}
+
+// integrity returns the Subresource Integrity value for the file at originalPath in
+// the fs.FS.
+func (hfs *HFS) integrity(originalPath string) string {
+	//In development mode, always calculate from the file's current contents.
+	if hfs.devMode {
+		fileContents, _, err := hfs.readFile(originalPath, nil)
+		if err != nil {
+			return ""
+		}
+
+		return hfs.calculateIntegrity(fileContents)
+	}
+
+	hashPath, err := hfs.getHashPath(originalPath, nil)
+	if err != nil {
+		return ""
+	}
+
+	hfs.mu.RLock()
+	rev := hfs.hashPathReverse[hashPath]
+	hfs.mu.RUnlock()
+	if rev.integrity != "" {
+		return rev.integrity
+	}
+
+	//The integrity will not be stored if the lookup tables were loaded from a
+	//manifest without integrity values. Calculate it now and store it for future
+	//use.
+	fileContents, _, err := hfs.readFile(originalPath, nil)
+	if err != nil {
+		return ""
+	}
+
+	rev.integrity = hfs.calculateIntegrity(fileContents)
+	hfs.updateReverse(hashPath, rev)
+
+	return rev.integrity
+}
+
+// calculateIntegrity calculates the Subresource Integrity value of a file's contents.
+func (hfs *HFS) calculateIntegrity(fileContents []byte) string {
+	var hash []byte
+
+	switch hfs.integrityAlgo {
+	case crypto.SHA256:
+		h := sha256.Sum256(fileContents)
+		hash = h[:]
+	case crypto.SHA384:
+		h := sha512.Sum384(fileContents)
+		hash = h[:]
+	case crypto.SHA512:
+		h := sha512.Sum512(fileContents)
+		hash = h[:]
+	default:
+		//This should never occur since we check if the algorithm is supported in
+		//the IntegrityAlgo option func.
+		return ""
+	}
+
+	return integrityPrefixes[hfs.integrityAlgo] + base64.StdEncoding.EncodeToString(hash)
+}
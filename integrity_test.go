@@ -0,0 +1,84 @@
+package hashfs
+
+import (
+	"crypto"
+	"testing"
+)
+
+// Integrity values for testdata/subdir1/script.js, generated via PC terminal, not
+// golang.
+const (
+	scriptjsSHA256Integrity = "sha256-6VlSPHzWNQyEelC6ZNGHaQDh7p3PO2xKu4prjmwTsmI="
+	scriptjsSHA384Integrity = "sha384-8j1oqAXmbPNK+Syfh5GQgIfXHfxgcUtmx8Wr+IHLwzZGsp7CdfS1NdDdtfyZ1voj"
+)
+
+func TestIntegrity(t *testing.T) {
+	originalPath := "testdata/subdir1/script.js"
+
+	t.Run("Default", func(t *testing.T) {
+		hfs := NewFS(fsys)
+
+		got := hfs.Integrity(originalPath)
+		if got != scriptjsSHA384Integrity {
+			t.Fatalf("bad integrity; \ngot:  %s, \nwant: %s", got, scriptjsSHA384Integrity)
+			return
+		}
+
+		//Should be stored alongside the hash.
+		rev := hfs.hashPathReverse[hfs.GetHashPath(originalPath)]
+		if rev.integrity != scriptjsSHA384Integrity {
+			t.Fatal("integrity not stored in lookup table")
+			return
+		}
+	})
+
+	t.Run("IndependentOfHashAlgo", func(t *testing.T) {
+		hfs := NewFS(fsys, HashAlgo(crypto.MD5), IntegrityAlgo(crypto.SHA256))
+
+		got := hfs.Integrity(originalPath)
+		if got != scriptjsSHA256Integrity {
+			t.Fatalf("bad integrity; \ngot:  %s, \nwant: %s", got, scriptjsSHA256Integrity)
+			return
+		}
+	})
+
+	t.Run("NotExist", func(t *testing.T) {
+		hfs := NewFS(fsys)
+
+		got := hfs.Integrity("testdata/missing.js")
+		if got != "" {
+			t.Fatal("expected blank integrity for missing file", got)
+			return
+		}
+	})
+
+	t.Run("ManifestWithoutIntegrity", func(t *testing.T) {
+		m := NewFS(fsys, Precompute()).Manifest()
+		for k, v := range m {
+			v.Integrity = ""
+			m[k] = v
+		}
+
+		hfs, err := NewFSFromManifest(fsys, m)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		got := hfs.Integrity(originalPath)
+		if got != scriptjsSHA384Integrity {
+			t.Fatalf("bad integrity; \ngot:  %s, \nwant: %s", got, scriptjsSHA384Integrity)
+			return
+		}
+	})
+
+	t.Run("BadAlgo", func(t *testing.T) {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatal("panic should have occured for bad integrity algo given")
+			}
+		}()
+
+		_ = NewFS(fsys, IntegrityAlgo(crypto.MD5))
+	})
+}
@@ -0,0 +1,279 @@
+package hashfs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"mime"
+	"path"
+)
+
+// Manifest is the mapping of each original path to information about the file's
+// hash. This is used to share the same original path to hash path mapping used by
+// your Go code with other tooling, such as frontend build tools or CDN upload
+// scripts.
+type Manifest map[string]ManifestEntry
+
+// ManifestEntry is the information stored about each file in a Manifest.
+type ManifestEntry struct {
+	HashPath    string `json:"hashPath"`
+	Hash        string `json:"hash"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"contentType,omitempty"`
+	Integrity   string `json:"integrity,omitempty"`
+}
+
+// viteManifestEntry is the information stored about each file in a Vite-shaped
+// manifest. This matches the format of the manifest.json file Vite generates so
+// that existing JS tooling can consume it. The integrity field matches what common
+// Vite SRI plugins add.
+//
+// https://vitejs.dev/guide/backend-integration.html
+type viteManifestEntry struct {
+	File      string `json:"file"`
+	Src       string `json:"src"`
+	Integrity string `json:"integrity,omitempty"`
+}
+
+// Manifest returns the mapping of each original path to the file's hash path, hash,
+// size, and content type.
+//
+// Only files that have been hashed are included. Use the Precompute option to NewFS,
+// or call HashAll, first if you want every file in the fs.FS to be included.
+func (hfs *HFS) Manifest() (m Manifest) {
+	hfs.mu.RLock()
+	defer hfs.mu.RUnlock()
+
+	m = make(Manifest, len(hfs.originalPathToHashPath))
+	for originalPath, hashPath := range hfs.originalPathToHashPath {
+		rev := hfs.hashPathReverse[hashPath]
+
+		m[originalPath] = ManifestEntry{
+			HashPath:    hashPath,
+			Hash:        rev.hash,
+			Size:        rev.size,
+			ContentType: mime.TypeByExtension(path.Ext(originalPath)),
+			Integrity:   rev.integrity,
+		}
+	}
+
+	return
+}
+
+// WriteManifest writes the Manifest, as JSON, to w. The JSON is an object keyed by
+// each original path.
+//
+//	{
+//	  "css/styles.css": {
+//	    "hashPath": "css/styles.css-a1b2c3...d4e5f6.css",
+//	    "hash": "a1b2c3...d4e5f6",
+//	    "size": 1234,
+//	    "contentType": "text/css; charset=utf-8",
+//	    "integrity": "sha384-..."
+//	  }
+//	}
+func (hfs *HFS) WriteManifest(w io.Writer) error {
+	return writeJSON(w, hfs.Manifest())
+}
+
+// WriteViteManifest writes the Manifest, as JSON, to w in the same format as the
+// manifest.json file generated by Vite. The JSON is an object keyed by each original
+// path.
+//
+//	{
+//	  "css/styles.css": {
+//	    "file": "css/styles.css-a1b2c3...d4e5f6.css",
+//	    "src": "css/styles.css",
+//	    "integrity": "sha384-..."
+//	  }
+//	}
+func (hfs *HFS) WriteViteManifest(w io.Writer) error {
+	m := hfs.Manifest()
+
+	vm := make(map[string]viteManifestEntry, len(m))
+	for originalPath, entry := range m {
+		vm[originalPath] = viteManifestEntry{
+			File:      entry.HashPath,
+			Src:       originalPath,
+			Integrity: entry.Integrity,
+		}
+	}
+
+	return writeJSON(w, vm)
+}
+
+// writeJSON writes v, as indented JSON, to w. Indenting is used since manifests are
+// typically written to files that may be inspected by a human.
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// ReadManifest reads a Manifest, as written by WriteManifest, from r. Vite-shaped
+// manifests cannot be read since they do not include each file's hash.
+func ReadManifest(r io.Reader) (m Manifest, err error) {
+	err = json.NewDecoder(r).Decode(&m)
+	return
+}
+
+// NewFSFromManifest returns the provided fs.FS with the lookup tables populated from
+// a prebuilt Manifest. This allows hashes to be calculated once, at build time, so
+// that no hashing work is done when your binary starts.
+//
+// Every file in the manifest must exist in the fs.FS, otherwise an error wrapping
+// ErrNotExist is returned, or ErrIsDir if the path is a directory. Each hash path
+// must be a valid path, otherwise an error wrapping ErrInvalidHashPath is returned.
+// Each hash path must also be used by only one file and must not be the original
+// path of another file, otherwise an error wrapping ErrHashCollision is returned.
+// Use the VerifyManifest option to also check the hashes in the manifest against the
+// files' contents.
+//
+// The Precompute option is ignored.
+//
+// The same options used when the manifest was generated, such as the hash location,
+// algorithm, and length, should be provided so that any files not listed in the
+// manifest are hashed consistently.
+func NewFSFromManifest(fsys fs.FS, m Manifest, options ...optionFunc) (*HFS, error) {
+	//Precompute is ignored since hashing every file defeats the purpose of using a
+	//manifest, and the lookup tables would be replaced by the manifest anyway.
+	options = append(options[:len(options):len(options)], func(hfs *HFS) {
+		hfs.precompute = false
+	})
+	hfs := NewFS(fsys, options...)
+
+	err := hfs.loadManifest(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return hfs, nil
+}
+
+// VerifyManifest causes NewFSFromManifest to check the hashes stored in the manifest
+// against the contents of the files in the fs.FS. The sample is the number of randomly
+// chosen entries to verify. If 0 is provided, every entry is verified.
+//
+// This is helpful for catching a manifest that was generated from different files,
+// or with different options, than are being served. Verifying every entry requires
+// reading every file, which defeats some of the purpose of using a manifest, so a
+// small sample is typically enough.
+func VerifyManifest(sample uint) optionFunc {
+	return func(hfs *HFS) {
+		hfs.verifyManifest = true
+		hfs.verifyManifestSample = sample
+	}
+}
+
+// loadManifest checks the entries in the manifest against the fs.FS and populates
+// the lookup tables. Errors for every bad entry are joined together and returned so
+// that all problems can be fixed at once. The lookup tables are not modified if any
+// error occurs.
+func (hfs *HFS) loadManifest(m Manifest) error {
+	//Make sure every file exists and every hash path is usable.
+	var errs []error
+	originalPaths := make([]string, 0, len(m))
+	hashPaths := make(map[string]string, len(m))
+	for originalPath, entry := range m {
+		info, err := fs.Stat(hfs.fsys, originalPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrNotExist, originalPath))
+			continue
+		} else if err != nil {
+			errs = append(errs, err)
+			continue
+		} else if info.IsDir() {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrIsDir, originalPath))
+			continue
+		}
+
+		if !fs.ValidPath(entry.HashPath) || entry.HashPath == "." {
+			errs = append(errs, fmt.Errorf("%w: %s, %q", ErrInvalidHashPath, originalPath, entry.HashPath))
+			continue
+		}
+		if other, exists := hashPaths[entry.HashPath]; exists {
+			errs = append(errs, fmt.Errorf("%w: %s and %s", ErrHashCollision, originalPath, other))
+			continue
+		}
+
+		//A hash path that is another file's original path would cause this file
+		//to be served, with aggressive caching, in place of the other file.
+		if _, exists := m[entry.HashPath]; exists && entry.HashPath != originalPath {
+			errs = append(errs, fmt.Errorf("%w: %s, hash path is the original path of %s", ErrHashCollision, originalPath, entry.HashPath))
+			continue
+		}
+		hashPaths[entry.HashPath] = originalPath
+
+		originalPaths = append(originalPaths, originalPath)
+	}
+
+	//Verify hashes, if needed.
+	if hfs.verifyManifest {
+		toVerify := originalPaths
+		if sample := int(hfs.verifyManifestSample); sample > 0 && sample < len(originalPaths) {
+			toVerify = make([]string, 0, sample)
+			for _, i := range rand.Perm(len(originalPaths))[:sample] {
+				toVerify = append(toVerify, originalPaths[i])
+			}
+		}
+
+		for _, originalPath := range toVerify {
+			err := hfs.verifyManifestEntry(originalPath, m[originalPath])
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	//Populate the lookup tables.
+	hfs.mu.Lock()
+	defer hfs.mu.Unlock()
+
+	for originalPath, entry := range m {
+		hfs.originalPathToHashPath[originalPath] = entry.HashPath
+		hfs.hashPathReverse[entry.HashPath] = reverse{
+			originalPath: originalPath,
+			hash:         entry.Hash,
+			size:         entry.Size,
+			integrity:    entry.Integrity,
+		}
+	}
+
+	return nil
+}
+
+// verifyManifestEntry reads the file at the originalPath and makes sure the hash
+// and hash path in the entry match what would be calculated from the file's contents.
+func (hfs *HFS) verifyManifestEntry(originalPath string, entry ManifestEntry) error {
+	fileContents, _, err := hfs.readFile(originalPath, nil)
+	if err != nil {
+		return err
+	}
+
+	hash := hfs.calculateHash(fileContents)
+	if hash != entry.Hash {
+		return fmt.Errorf("%w: %s", ErrHashMismatch, originalPath)
+	}
+
+	pathHash, err := hfs.pathHash(hash)
+	if err != nil {
+		return err
+	}
+	hashPath := hfs.buildHashPath(originalPath, pathHash)
+	if hashPath != entry.HashPath {
+		return fmt.Errorf("%w: %s, hash path %s does not match %s", ErrHashMismatch, originalPath, entry.HashPath, hashPath)
+	}
+
+	if entry.Integrity != "" && entry.Integrity != hfs.calculateIntegrity(fileContents) {
+		return fmt.Errorf("%w: %s, integrity does not match", ErrHashMismatch, originalPath)
+	}
+
+	return nil
+}
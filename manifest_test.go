@@ -0,0 +1,260 @@
+package hashfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	hfs := NewFS(fsys, Precompute())
+
+	m := hfs.Manifest()
+	if len(m) != 4 {
+		t.Fatalf("bad manifest length; \ngot:  %d, \nwant: %d", len(m), 4)
+		return
+	}
+
+	originalPath := "testdata/sub.dir.2/text.txt"
+	entry, exists := m[originalPath]
+	if !exists {
+		t.Fatal("file missing from manifest", originalPath)
+		return
+	}
+
+	want := ManifestEntry{
+		HashPath:    "testdata/sub.dir.2/text.txt-" + texttxt + ".txt",
+		Hash:        texttxt,
+		Size:        int64(len("testdata")),
+		ContentType: "text/plain; charset=utf-8",
+		Integrity:   "sha384-SN5oSMR+DBSCs8oTBnjAk/K4YgNM6YTt2sIWJnx3R417hCYJajv79w6fXvrGmWwa",
+	}
+	if entry != want {
+		t.Fatalf("bad manifest entry; \ngot:  %+v, \nwant: %+v", entry, want)
+		return
+	}
+}
+
+func TestWriteManifest(t *testing.T) {
+	hfs := NewFS(fsys, Precompute())
+	originalPath := "testdata/subdir1/script.js"
+	hashPath := "testdata/subdir1/script.js-" + scriptjs + ".js"
+
+	t.Run("Flat", func(t *testing.T) {
+		var b bytes.Buffer
+		err := hfs.WriteManifest(&b)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		var m Manifest
+		err = json.Unmarshal(b.Bytes(), &m)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if m[originalPath].HashPath != hashPath {
+			t.Fatalf("bad hash path; \ngot:  %s, \nwant: %s", m[originalPath].HashPath, hashPath)
+			return
+		}
+		if m[originalPath].Hash != scriptjs {
+			t.Fatalf("bad hash; \ngot:  %s, \nwant: %s", m[originalPath].Hash, scriptjs)
+			return
+		}
+	})
+
+	t.Run("Vite", func(t *testing.T) {
+		var b bytes.Buffer
+		err := hfs.WriteViteManifest(&b)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		var m map[string]struct {
+			File string `json:"file"`
+			Src  string `json:"src"`
+		}
+		err = json.Unmarshal(b.Bytes(), &m)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if m[originalPath].File != hashPath {
+			t.Fatalf("bad file; \ngot:  %s, \nwant: %s", m[originalPath].File, hashPath)
+			return
+		}
+		if m[originalPath].Src != originalPath {
+			t.Fatalf("bad src; \ngot:  %s, \nwant: %s", m[originalPath].Src, originalPath)
+			return
+		}
+	})
+}
+
+func TestNewFSFromManifest(t *testing.T) {
+	//Build a manifest to load.
+	m := NewFS(fsys, Precompute()).Manifest()
+
+	t.Run("Load", func(t *testing.T) {
+		hfs, err := NewFSFromManifest(fsys, m)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		originalPath := "testdata/subdir1/script.js"
+		want := "testdata/subdir1/script.js-" + scriptjs + ".js"
+		if got := hfs.originalPathToHashPath[originalPath]; got != want {
+			t.Fatalf("bad hash path; \ngot:  %s, \nwant: %s", got, want)
+			return
+		}
+		if rev := hfs.hashPathReverse[want]; rev.originalPath != originalPath || rev.hash != scriptjs {
+			t.Fatal("reverse lookup not populated", rev)
+			return
+		}
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		var b bytes.Buffer
+		err := NewFS(fsys, Precompute()).WriteManifest(&b)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		rm, err := ReadManifest(&b)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		hfs, err := NewFSFromManifest(fsys, rm, VerifyManifest(0))
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if len(hfs.originalPathToHashPath) != len(m) {
+			t.Fatal("not all entries loaded")
+			return
+		}
+	})
+
+	t.Run("MissingFile", func(t *testing.T) {
+		bad := Manifest{"testdata/missing.js": ManifestEntry{HashPath: "testdata/missing.js-abc.js", Hash: "abc"}}
+
+		_, err := NewFSFromManifest(fsys, bad)
+		if !errors.Is(err, ErrNotExist) {
+			t.Fatal("expected ErrNotExist", err)
+			return
+		}
+	})
+
+	t.Run("Directory", func(t *testing.T) {
+		bad := Manifest{"testdata/subdir1": ManifestEntry{HashPath: "testdata/subdir1-abc", Hash: "abc"}}
+
+		_, err := NewFSFromManifest(fsys, bad)
+		if !errors.Is(err, ErrIsDir) {
+			t.Fatal("expected ErrIsDir", err)
+			return
+		}
+	})
+
+	t.Run("BadHashPath", func(t *testing.T) {
+		originalPath := "testdata/subdir1/script.js"
+		for _, hashPath := range []string{"", "../../etc/passwd", "/testdata/subdir1/script.js"} {
+			bad := Manifest{originalPath: ManifestEntry{HashPath: hashPath, Hash: scriptjs}}
+
+			_, err := NewFSFromManifest(fsys, bad)
+			if !errors.Is(err, ErrInvalidHashPath) {
+				t.Fatal("expected ErrInvalidHashPath", hashPath, err)
+				return
+			}
+			if errors.Is(err, ErrHashCollision) {
+				t.Fatal("invalid hash path is not a collision", hashPath, err)
+				return
+			}
+		}
+	})
+
+	t.Run("HashPathIsOriginalPath", func(t *testing.T) {
+		bad := Manifest{}
+		for k, v := range m {
+			bad[k] = v
+		}
+		entry := bad["testdata/subdir1/script.js"]
+		entry.HashPath = "testdata/subdir1/styles.min.css"
+		bad["testdata/subdir1/script.js"] = entry
+
+		_, err := NewFSFromManifest(fsys, bad)
+		if !errors.Is(err, ErrHashCollision) {
+			t.Fatal("expected ErrHashCollision", err)
+			return
+		}
+	})
+
+	t.Run("DuplicateHashPath", func(t *testing.T) {
+		bad := Manifest{}
+		for k, v := range m {
+			bad[k] = v
+		}
+		entry := bad["testdata/subdir1/script.js"]
+		entry.HashPath = m["testdata/subdir1/styles.min.css"].HashPath
+		bad["testdata/subdir1/script.js"] = entry
+
+		_, err := NewFSFromManifest(fsys, bad)
+		if !errors.Is(err, ErrHashCollision) {
+			t.Fatal("expected ErrHashCollision", err)
+			return
+		}
+	})
+
+	t.Run("Precompute", func(t *testing.T) {
+		originalPath := "testdata/subdir1/script.js"
+		small := Manifest{originalPath: m[originalPath]}
+
+		//Only the manifest's entries should be loaded, rather than every file
+		//being hashed.
+		hfs, err := NewFSFromManifest(fsys, small, Precompute())
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if len(hfs.originalPathToHashPath) != 1 {
+			t.Fatal("precompute should be skipped", len(hfs.originalPathToHashPath))
+			return
+		}
+	})
+
+	t.Run("VerifyMismatch", func(t *testing.T) {
+		bad := Manifest{}
+		for k, v := range m {
+			bad[k] = v
+		}
+		entry := bad["testdata/subdir1/script.js"]
+		entry.Hash = "abc"
+		bad["testdata/subdir1/script.js"] = entry
+
+		//Not verifying should load the bad manifest.
+		_, err := NewFSFromManifest(fsys, bad)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		_, err = NewFSFromManifest(fsys, bad, VerifyManifest(0))
+		if !errors.Is(err, ErrHashMismatch) {
+			t.Fatal("expected ErrHashMismatch", err)
+			return
+		}
+	})
+
+	t.Run("VerifyOptionsMismatch", func(t *testing.T) {
+		_, err := NewFSFromManifest(fsys, m, VerifyManifest(1), HashLocationStart())
+		if !errors.Is(err, ErrHashMismatch) {
+			t.Fatal("expected ErrHashMismatch", err)
+			return
+		}
+	})
+}
@@ -0,0 +1,267 @@
+package hashfs
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidPattern is returned by ValidateFilenamePattern, and used to panic in the
+// FilenamePattern option, when a filename pattern cannot be used.
+var ErrInvalidPattern = errors.New("hashfs: invalid filename pattern")
+
+// Tokens used in filename patterns.
+const (
+	tokenDir  = "dir"
+	tokenName = "name"
+	tokenHash = "hash"
+	tokenExt  = "ext"
+)
+
+// patternPart is a piece of a filename pattern, either literal text or a token.
+type patternPart struct {
+	literal string
+	token   string
+}
+
+// filenamePattern is a parsed filename pattern.
+type filenamePattern struct {
+	parts      []patternPart
+	hashLength uint
+	hasExt     bool
+
+	//re matches hash paths built from the pattern. This is compiled when NewFS is
+	//called since it depends on the hash length and hash encoding.
+	re *regexp.Regexp
+}
+
+// FilenamePattern sets a pattern used to build hash paths, overriding the hash
+// location. This allows matching the naming conventions used by other tools, i.e.
+// Vite's "[name].[hash:8].[ext]". The tokens are:
+//   - [dir]: the directory of the file, with a trailing slash, i.e. "css/". This is
+//     optional and, if used, must be at the start of the pattern. Hash paths always
+//     start with the file's directory.
+//   - [name]: the file's name without the extension, i.e. "styles.min". If [ext] is
+//     not used, this is the file's full name, i.e. "styles.min.css". Required.
+//   - [hash] or [hash:N]: the hash, optionally trimmed to N characters which
+//     overrides HashLength. Required.
+//   - [ext]: the file's extension without the period, i.e. "css". This must directly
+//     follow a period, which is removed if the file doesn't have an extension.
+//
+// Anything else in the pattern is used as-is. This will panic, with an error
+// wrapping ErrInvalidPattern, if the pattern is invalid. Use ValidateFilenamePattern
+// to check a pattern beforehand if it isn't hard-coded.
+func FilenamePattern(pattern string) optionFunc {
+	return func(hfs *HFS) {
+		p, err := parseFilenamePattern(pattern)
+		if err != nil {
+			panic(err)
+		}
+
+		hfs.filenamePattern = p
+	}
+}
+
+// ValidateFilenamePattern returns an error, wrapping ErrInvalidPattern, if the
+// pattern cannot be used with the FilenamePattern option.
+func ValidateFilenamePattern(pattern string) error {
+	_, err := parseFilenamePattern(pattern)
+	return err
+}
+
+// parseFilenamePattern parses a filename pattern into literal text and tokens.
+func parseFilenamePattern(pattern string) (*filenamePattern, error) {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w: %q: %s", ErrInvalidPattern, pattern, reason)
+	}
+
+	p := &filenamePattern{}
+	seen := make(map[string]bool)
+	rest := pattern
+	for rest != "" {
+		//Literal text up until the next token.
+		i := strings.Index(rest, "[")
+		if i == -1 {
+			i = len(rest)
+		}
+		if i > 0 {
+			literal := rest[:i]
+			if strings.Contains(literal, "]") {
+				return nil, invalid("unexpected ]")
+			}
+			p.parts = append(p.parts, patternPart{literal: literal})
+			rest = rest[i:]
+			continue
+		}
+
+		//A token.
+		end := strings.Index(rest, "]")
+		if end == -1 {
+			return nil, invalid("unclosed [")
+		}
+		token, arg, hasArg := strings.Cut(rest[1:end], ":")
+		rest = rest[end+1:]
+
+		switch token {
+		case tokenDir, tokenName, tokenExt:
+			if hasArg {
+				return nil, invalid("[" + token + "] does not take a length")
+			}
+		case tokenHash:
+			if hasArg {
+				l, err := strconv.ParseUint(arg, 10, 0)
+				if err != nil || l == 0 {
+					return nil, invalid("bad hash length " + arg)
+				}
+				p.hashLength = uint(l)
+			}
+		default:
+			return nil, invalid("unknown token [" + token + "]")
+		}
+
+		if seen[token] {
+			return nil, invalid("[" + token + "] used more than once")
+		}
+		if token == tokenDir && len(p.parts) > 0 {
+			return nil, invalid("[dir] must be at the start")
+		}
+		if token == tokenExt && (len(p.parts) == 0 || !strings.HasSuffix(p.parts[len(p.parts)-1].literal, ".")) {
+			return nil, invalid("[ext] must directly follow a period")
+		}
+		seen[token] = true
+		p.parts = append(p.parts, patternPart{token: token})
+	}
+
+	if !seen[tokenName] {
+		return nil, invalid("[name] is required")
+	}
+	if !seen[tokenHash] {
+		return nil, invalid("[hash] is required")
+	}
+
+	p.hasExt = seen[tokenExt]
+
+	//Hash paths are always in the file's directory, so [dir] is implied.
+	if !seen[tokenDir] {
+		p.parts = append([]patternPart{{token: tokenDir}}, p.parts...)
+	}
+
+	//Make sure the pattern can't build paths outside of the file's directory. Each
+	//token is replaced with a placeholder so that only whole path segments, after
+	//the directory, are checked.
+	var segments strings.Builder
+	for _, part := range p.parts[1:] {
+		if part.token != "" {
+			segments.WriteString("x")
+			continue
+		}
+		segments.WriteString(part.literal)
+	}
+	for _, segment := range strings.Split(segments.String(), "/") {
+		switch segment {
+		case "":
+			return nil, invalid("empty path segment")
+		case ".", "..":
+			return nil, invalid("relative path segment")
+		}
+	}
+
+	return p, nil
+}
+
+// build returns the hash path for the file at originalPath.
+func (p *filenamePattern) build(originalPath, hash string) string {
+	dir, name := path.Split(originalPath)
+	var ext string
+	if p.hasExt {
+		ext = path.Ext(name)
+		name = strings.TrimSuffix(name, ext)
+		ext = strings.TrimPrefix(ext, ".")
+	}
+
+	var b strings.Builder
+	for i, part := range p.parts {
+		switch part.token {
+		case "":
+			literal := part.literal
+			if ext == "" && i+1 < len(p.parts) && p.parts[i+1].token == tokenExt {
+				literal = strings.TrimSuffix(literal, ".")
+			}
+			b.WriteString(literal)
+		case tokenDir:
+			b.WriteString(dir)
+		case tokenName:
+			b.WriteString(name)
+		case tokenHash:
+			b.WriteString(hash)
+		case tokenExt:
+			b.WriteString(ext)
+		}
+	}
+
+	return b.String()
+}
+
+// compile builds the regular expression used to parse hash paths built from the
+// pattern. hashLength is the number of characters in each hash and hashChars is a
+// regular expression character class matching the characters in a hash.
+func (p *filenamePattern) compile(hashLength int, hashChars string) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i, part := range p.parts {
+		switch part.token {
+		case "":
+			literal := part.literal
+			if i+1 < len(p.parts) && p.parts[i+1].token == tokenExt {
+				//The period before [ext] is removed if the file doesn't have an
+				//extension, so it is matched along with the extension.
+				b.WriteString(regexp.QuoteMeta(strings.TrimSuffix(literal, ".")))
+				continue
+			}
+			b.WriteString(regexp.QuoteMeta(literal))
+		case tokenDir:
+			b.WriteString(`(?P<dir>(?:[^/]+/)*)`)
+		case tokenName:
+			b.WriteString(`(?P<name>[^/]+)`)
+		case tokenHash:
+			b.WriteString(`(?P<hash>` + hashChars + `{` + strconv.Itoa(hashLength) + `})`)
+		case tokenExt:
+			b.WriteString(`(?:\.(?P<ext>[^./]+))?`)
+		}
+	}
+	b.WriteString("$")
+
+	p.re = regexp.MustCompile(b.String())
+}
+
+// parse extracts the original path and the hash from a hash path built from the
+// pattern. False is returned if the path doesn't match the pattern.
+func (p *filenamePattern) parse(hashPath string) (originalPath, hash string, ok bool) {
+	m := p.re.FindStringSubmatch(hashPath)
+	if m == nil {
+		return "", "", false
+	}
+
+	var dir, name, ext string
+	for i, group := range p.re.SubexpNames() {
+		switch group {
+		case tokenDir:
+			dir = m[i]
+		case tokenName:
+			name = m[i]
+		case tokenHash:
+			hash = m[i]
+		case tokenExt:
+			ext = m[i]
+		}
+	}
+
+	originalPath = dir + name
+	if ext != "" {
+		originalPath += "." + ext
+	}
+	return originalPath, hash, true
+}
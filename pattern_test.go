@@ -0,0 +1,154 @@
+package hashfs
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFilenamePattern(t *testing.T) {
+	t.Run("Build", func(t *testing.T) {
+		tests := []struct {
+			pattern      string
+			originalPath string
+			want         string
+		}{
+			{"[name].[hash:8].[ext]", "css/styles.min.css", "css/styles.min.a1b2c3d4.css"},
+			{"[name].[hash:8].[ext]", "indexhtml", "indexhtml.a1b2c3d4"},
+			{"[dir][name]-[hash].[ext]", "a/b/script.js", "a/b/script-a1b2c3d4.js"},
+			{"[hash:8]/[name].[ext]", "img/logo.png", "img/a1b2c3d4/logo.png"},
+		}
+
+		for _, tt := range tests {
+			hfs := NewFS(fsys, FilenamePattern(tt.pattern))
+			got := hfs.buildHashPath(tt.originalPath, "a1b2c3d4")
+			if got != tt.want {
+				t.Fatalf("bad hash path for %s; \ngot:  %s, \nwant: %s", tt.pattern, got, tt.want)
+				return
+			}
+		}
+	})
+
+	t.Run("Parse", func(t *testing.T) {
+		patterns := []string{
+			"[name].[hash:8].[ext]",
+			"[hash]-[name].[ext]",
+			"[dir][name]-[hash:16]",
+			"[hash:10]/[name].[ext]",
+			"[name][hash:8].[ext]",
+		}
+		originalPaths := []string{
+			"testdata/subdir1/script.js",
+			"testdata/subdir1/styles.min.css",
+			"testdata/subdir1/indexhtml",
+			"testdata/sub.dir.2/text.txt",
+		}
+
+		for _, pattern := range patterns {
+			hfs := NewFS(fsys, FilenamePattern(pattern))
+
+			for _, originalPath := range originalPaths {
+				hashPath, err := hfs.GetHashPathE(originalPath)
+				if err != nil {
+					t.Fatal(err)
+					return
+				}
+
+				gotPath, gotHash, ok := hfs.parseHashPath(hashPath)
+				if !ok {
+					t.Fatal("could not parse hash path", pattern, hashPath)
+					return
+				}
+				if gotPath != originalPath {
+					t.Fatalf("bad original path for %s; \ngot:  %s, \nwant: %s", pattern, gotPath, originalPath)
+					return
+				}
+				if want := hfs.hashPathReverse[hashPath].hash; gotHash != want {
+					t.Fatalf("bad hash for %s; \ngot:  %s, \nwant: %s", pattern, gotHash, want)
+					return
+				}
+
+				//A new HFS, i.e. another replica, must be able to serve the hash path.
+				r := httptest.NewRequest("GET", "/"+hashPath, nil)
+				w := httptest.NewRecorder()
+				FileServer(NewFS(fsys, FilenamePattern(pattern))).ServeHTTP(w, r)
+				if w.Code != http.StatusOK {
+					t.Fatal("bad code", w.Code, hashPath)
+					return
+				}
+				if got, want := w.Header().Get("ETag"), entityTag(gotHash, ""); got != want {
+					t.Fatalf("bad etag; \ngot:  %s, \nwant: %s", got, want)
+					return
+				}
+			}
+		}
+	})
+
+	t.Run("HashLength", func(t *testing.T) {
+		hfs := NewFS(fsys, HashLength(20), FilenamePattern("[name].[hash:8].[ext]"))
+		got := hfs.GetHashPath("testdata/subdir1/script.js")
+		want := "testdata/subdir1/script." + scriptjs[:8] + ".js"
+		if got != want {
+			t.Fatalf("bad hash path; \ngot:  %s, \nwant: %s", got, want)
+			return
+		}
+	})
+
+	t.Run("ContentType", func(t *testing.T) {
+		//The hash follows the extension, so the Content-Type must come from the
+		//original path.
+		hfs := NewFS(fsys, FilenamePattern("[name].[hash:8]"))
+		hashPath := hfs.GetHashPath("testdata/subdir1/script.js")
+
+		r := httptest.NewRequest("GET", "/"+hashPath, nil)
+		w := httptest.NewRecorder()
+		FileServer(hfs).ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatal("bad code", w.Code, hashPath)
+			return
+		}
+		if got, want := w.Header().Get("Content-Type"), mime.TypeByExtension(".js"); got != want {
+			t.Fatalf("bad content-type; \ngot:  %s, \nwant: %s", got, want)
+			return
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		invalid := []string{
+			"",
+			"[name].[ext]",
+			"[hash].[ext]",
+			"[name].[hash].[hash]",
+			"[name].[hash:0].[ext]",
+			"[name].[hash:x].[ext]",
+			"[name].[hash.[ext]",
+			"[name]].[hash]",
+			"[name].[hash].[extension]",
+			"[name].[ext:3].[hash]",
+			"[name]/[dir][hash]",
+			"../[name].[hash]",
+			"/[name].[hash]",
+			"[hash]//[name]",
+			"[name].[hash][ext]",
+			"[ext].[name].[hash]",
+		}
+
+		for _, pattern := range invalid {
+			err := ValidateFilenamePattern(pattern)
+			if !errors.Is(err, ErrInvalidPattern) {
+				t.Fatal("expected ErrInvalidPattern", pattern, err)
+				return
+			}
+		}
+
+		defer func() {
+			r := recover()
+			if err, ok := r.(error); !ok || !errors.Is(err, ErrInvalidPattern) {
+				t.Fatal("expected panic with ErrInvalidPattern", r)
+			}
+		}()
+		_ = NewFS(fsys, FilenamePattern("[name]"))
+	})
+}
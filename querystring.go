@@ -0,0 +1,131 @@
+package hashfs
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// queryStringParam is the name of the query string parameter the hash is added to
+// when QueryStringMode is used.
+const queryStringParam = "v"
+
+// queryStringMaxAge is how long browsers may cache a file requested without the
+// file's current hash when QueryStringMode is used. This is kept short since the
+// file's contents may change without the URL changing.
+const queryStringMaxAge = time.Minute
+
+// QueryStringMode sets the hash to be added as a query string parameter, leaving
+// the file's path intact. css/styles.css becomes css/styles.css?v=a1b2c3...d4e5f6.
+//
+// This is helpful for clients and proxies that don't handle renamed files well, and
+// for files loaded by third-party code that expects a specific filename. Note that
+// some proxies don't cache URLs with a query string at all.
+//
+// FileServer only sets the aggressive caching headers when the v parameter matches
+// the file's current hash. Requests with a missing or outdated v parameter are
+// served the file's current contents with a short max-age, or are redirected to the
+// current hash path if the RedirectOriginalPaths or RedirectStaleHashPaths options
+// were provided. A retained version of the file, if a RetentionStore was provided,
+// is served for an outdated v parameter before redirecting.
+//
+// A FilenamePattern, if provided, overrides this.
+func QueryStringMode() optionFunc {
+	return func(hfs *HFS) {
+		hfs.hashLocation = hashLocationQueryString
+	}
+}
+
+// queryStringMode returns true if the hash is added as a query string parameter.
+func (hfs *HFS) queryStringMode() bool {
+	return hfs.hashLocation == hashLocationQueryString && hfs.filenamePattern == nil && !hfs.devMode
+}
+
+// resolveQueryString returns the hash path to serve for a request for the original
+// path when QueryStringMode is used. The hash is taken from the v parameter.
+//
+// If the v parameter doesn't match the file's current hash, the request may be
+// served from the RetentionStore or redirected, in which case handled is true.
+// Otherwise, the current hash path is returned with stale set to true so that the
+// file is only cached briefly.
+func (hfs *HFS) resolveQueryString(w http.ResponseWriter, r *http.Request, originalPath string) (hashPath string, stale, handled bool) {
+	v := r.URL.Query().Get(queryStringParam)
+
+	current, err := hfs.getHashPath(originalPath, nil)
+	if err != nil {
+		//The file may have been removed, but a previous version may be retained.
+		if v != "" && hfs.serveRetained(w, r, hfs.buildHashPath(originalPath, v)) {
+			return "", false, true
+		}
+
+		return originalPath, false, false
+	}
+
+	if v == "" {
+		if hfs.redirectOriginal(w, r, originalPath) {
+			return "", false, true
+		}
+
+		return current, true, false
+	}
+
+	requested := hfs.buildHashPath(originalPath, v)
+	if requested == current {
+		return current, false, false
+	}
+
+	if hfs.serveRetained(w, r, requested) || hfs.redirectStale(w, r, requested) {
+		return "", false, true
+	}
+
+	return current, true, false
+}
+
+// queryStringCacheControl returns the value stored in the Cache-Control header for
+// files requested without the file's current hash when QueryStringMode is used.
+func queryStringCacheControl() string {
+	return "public, max-age=" + strconv.Itoa(int(queryStringMaxAge.Seconds()))
+}
+
+// joinQuery adds a query string and/or fragment, i.e. ?a=1#top, to a hash path. The
+// query strings are combined, using sep, if the hash path already has a query string
+// since the hash is added as a query string parameter when QueryStringMode is used.
+func joinQuery(hashPath, suffix, sep string) string {
+	if strings.Contains(hashPath, "?") && strings.HasPrefix(suffix, "?") {
+		//Drop an empty query string, i.e. the ? in font.woff2?#iefix.
+		rest := suffix[1:]
+		if rest == "" || rest[0] == '#' {
+			return hashPath + rest
+		}
+
+		return hashPath + sep + rest
+	}
+
+	return hashPath + suffix
+}
+
+// mergeQuery combines the query string from a hash path with a request's query
+// string. Parameters in the hash path's query string replace those in the request's
+// query string.
+func mergeQuery(hashPathQuery, rawQuery string) string {
+	if hashPathQuery == "" {
+		return rawQuery
+	}
+
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return hashPathQuery
+	}
+
+	replace, _ := url.ParseQuery(hashPathQuery)
+	for key := range replace {
+		values.Del(key)
+	}
+	if len(values) == 0 {
+		return hashPathQuery
+	}
+
+	return hashPathQuery + "&" + values.Encode()
+}
@@ -0,0 +1,145 @@
+package hashfs
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestQueryStringMode(t *testing.T) {
+	originalPath := "testdata/subdir1/script.js"
+	hashPath := originalPath + "?v=" + scriptjs
+
+	t.Run("HashPath", func(t *testing.T) {
+		hfs := NewFS(fsys, QueryStringMode())
+		got := hfs.GetHashPath(originalPath)
+		if got != hashPath {
+			t.Fatalf("bad hash path; \ngot:  %s, \nwant: %s", got, hashPath)
+			return
+		}
+
+		gotOriginalPath, gotHash, ok := hfs.parseHashPath(hashPath)
+		if !ok || gotOriginalPath != originalPath || gotHash != scriptjs {
+			t.Fatal("could not parse hash path", gotOriginalPath, gotHash, ok)
+			return
+		}
+
+		//The hash path can be opened via the fs.FS interface.
+		f, err := hfs.Open(hashPath)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		f.Close()
+	})
+
+	t.Run("FileServer", func(t *testing.T) {
+		tests := []struct {
+			name         string
+			url          string
+			cacheControl string
+		}{
+			{"Current", "/" + hashPath, NewFS(fsys).getCacheControl()},
+			{"Missing", "/" + originalPath, queryStringCacheControl()},
+			{"Stale", "/" + originalPath + "?v=" + stylesmincss, queryStringCacheControl()},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				hfs := NewFS(fsys, QueryStringMode())
+				r := httptest.NewRequest("GET", tt.url, nil)
+				w := httptest.NewRecorder()
+				FileServer(hfs).ServeHTTP(w, r)
+				if w.Code != http.StatusOK {
+					t.Fatal("bad code", w.Code)
+					return
+				}
+				if got := w.Header().Get("Cache-Control"); got != tt.cacheControl {
+					t.Fatalf("bad cache-control; \ngot:  %s, \nwant: %s", got, tt.cacheControl)
+					return
+				}
+				if got := w.Header().Get("ETag"); got != entityTag(scriptjs, "") {
+					t.Fatalf("bad etag; \ngot:  %s, \nwant: %s", got, entityTag(scriptjs, ""))
+					return
+				}
+			})
+		}
+	})
+
+	t.Run("Redirect", func(t *testing.T) {
+		hfs := NewFS(fsys, QueryStringMode(), RedirectOriginalPaths(http.StatusFound), RedirectStaleHashPaths(http.StatusTemporaryRedirect))
+
+		tests := []struct {
+			name     string
+			url      string
+			status   int
+			location string
+		}{
+			{"Missing", "/" + originalPath + "?x=1", http.StatusFound, "./script.js?v=" + scriptjs + "&x=1"},
+			{"Stale", "/" + originalPath + "?v=" + stylesmincss, http.StatusTemporaryRedirect, "./script.js?v=" + scriptjs},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				r := httptest.NewRequest("GET", tt.url, nil)
+				w := httptest.NewRecorder()
+				FileServer(hfs).ServeHTTP(w, r)
+				if w.Code != tt.status {
+					t.Fatal("bad code", w.Code)
+					return
+				}
+				if got := w.Header().Get("Location"); got != tt.location {
+					t.Fatalf("bad location; \ngot:  %s, \nwant: %s", got, tt.location)
+					return
+				}
+			})
+		}
+
+		//Current hash paths are served, not redirected.
+		r := httptest.NewRequest("GET", "/"+hashPath, nil)
+		w := httptest.NewRecorder()
+		FileServer(hfs).ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatal("bad code", w.Code)
+			return
+		}
+	})
+
+	t.Run("Rewrite", func(t *testing.T) {
+		mfs := fstest.MapFS{
+			"css/styles.css": {Data: []byte(`@font-face { src: url(../fonts/x.woff2?#iefix), url("../fonts/x.woff?a=1"); }`)},
+			"fonts/x.woff2":  {Data: []byte("woff2")},
+			"fonts/x.woff":   {Data: []byte("woff")},
+		}
+		hfs := NewFS(mfs, QueryStringMode(), RewriteCSS(), HashLength(8))
+
+		cssHashPath := hfs.GetHashPath("css/styles.css")
+		content := string(hfs.hashPathReverse[cssHashPath].content)
+		want := `@font-face { src: url(../` + hfs.GetHashPath("fonts/x.woff2") + `#iefix), url("../` + hfs.GetHashPath("fonts/x.woff") + `&a=1"); }`
+		if content != want {
+			t.Fatalf("bad rewritten content; \ngot:  %s, \nwant: %s", content, want)
+			return
+		}
+	})
+
+	t.Run("HTMLMiddleware", func(t *testing.T) {
+		mfs := fstest.MapFS{
+			"css/styles.css": {Data: []byte("body {}")},
+		}
+		hfs := NewFS(mfs, QueryStringMode(), HashLength(8))
+
+		h := HTMLMiddleware(hfs, "/static/")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			io.WriteString(w, `<link href="/static/css/styles.css?x=1&amp;y=2">`)
+		}))
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+		want := `<link href="/static/` + hfs.GetHashPath("css/styles.css") + `&amp;x=1&amp;y=2">`
+		if got := w.Body.String(); got != want {
+			t.Fatalf("bad rewritten html; \ngot:  %s, \nwant: %s", got, want)
+			return
+		}
+	})
+}
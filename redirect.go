@@ -0,0 +1,149 @@
+package hashfs
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redirectMaxAge is how long browsers may cache redirects to hash paths. This is
+// kept short since the hash path a redirect points to changes whenever the file's
+// contents change.
+const redirectMaxAge = time.Minute
+
+// RedirectOriginalPaths causes FileServer to respond to requests for original paths
+// with a redirect to the file's current hash path, rather than serving the file
+// without caching headers. This is helpful for links you don't control, i.e. in
+// old emails or on other sites, so that the file is still cached aggressively.
+//
+// The status must be http.StatusFound (302) or http.StatusTemporaryRedirect (307).
+// A redirect is never permanent since the hash path changes with the file's contents.
+//
+// Only files whose original path matches one of the patterns, using path.Match
+// syntax, are redirected. Patterns without a slash are also matched against the
+// filename alone, so "*.png" matches images/logo.png. If no patterns are provided,
+// every file is redirected.
+//
+//	hashfs.RedirectOriginalPaths(http.StatusFound, "images/*", "*.png")
+//
+// This is ignored when DevMode is used.
+func RedirectOriginalPaths(status int, patterns ...string) optionFunc {
+	return func(hfs *HFS) {
+		checkRedirectStatus(status)
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				panic("invalid redirect pattern: " + pattern)
+			}
+		}
+
+		hfs.redirectOriginalStatus = status
+		hfs.redirectOriginalPatterns = patterns
+	}
+}
+
+// RedirectStaleHashPaths causes FileServer to respond to requests for hash paths
+// with an outdated hash, i.e. the file's contents have changed since the hash path
+// was rendered, with a redirect to the file's current hash path rather than a 404.
+// Stale hash paths are only redirected if the RetentionStore, if any, doesn't have
+// the requested version of the file.
+//
+// The status must be http.StatusFound (302) or http.StatusTemporaryRedirect (307).
+//
+// This is ignored when DevMode is used.
+func RedirectStaleHashPaths(status int) optionFunc {
+	return func(hfs *HFS) {
+		checkRedirectStatus(status)
+		hfs.redirectStaleStatus = status
+	}
+}
+
+// checkRedirectStatus panics if the status is not supported for redirects.
+func checkRedirectStatus(status int) {
+	if status != http.StatusFound && status != http.StatusTemporaryRedirect {
+		panic("unsupported redirect status used")
+	}
+}
+
+// redirectOriginal redirects a request for an original path to the file's hash
+// path. True is returned if a redirect was written.
+func (hfs *HFS) redirectOriginal(w http.ResponseWriter, r *http.Request, originalPath string) bool {
+	if hfs.redirectOriginalStatus == 0 || hfs.devMode {
+		return false
+	}
+
+	if len(hfs.redirectOriginalPatterns) > 0 {
+		matched := false
+		for _, pattern := range hfs.redirectOriginalPatterns {
+			if ok, _ := path.Match(pattern, originalPath); ok {
+				matched = true
+				break
+			}
+
+			//Since * doesn't match a slash, match patterns without a slash
+			//against the filename, i.e. *.png should match images/logo.png.
+			if !strings.Contains(pattern, "/") {
+				if ok, _ := path.Match(pattern, path.Base(originalPath)); ok {
+					matched = true
+					break
+				}
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	hashPath, err := hfs.getHashPath(originalPath, nil)
+	if err != nil || hashPath == originalPath {
+		return false
+	}
+
+	redirect(w, r, originalPath, hashPath, hfs.redirectOriginalStatus)
+	return true
+}
+
+// redirectStale redirects a request for a hash path with an outdated hash to the
+// file's current hash path. True is returned if a redirect was written.
+func (hfs *HFS) redirectStale(w http.ResponseWriter, r *http.Request, stalePath string) bool {
+	if hfs.redirectStaleStatus == 0 || hfs.devMode {
+		return false
+	}
+
+	originalPath, _, ok := hfs.parseHashPath(stalePath)
+	if !ok {
+		return false
+	}
+
+	hashPath, err := hfs.getHashPath(originalPath, nil)
+	if err != nil || hashPath == stalePath {
+		return false
+	}
+
+	redirect(w, r, stalePath, hashPath, hfs.redirectStaleStatus)
+	return true
+}
+
+// redirect writes a redirect from one path in the fs.FS to another. The Location
+// is relative to the requested path so that redirects work no matter what URL path
+// FileServer is served from, i.e. when wrapped in http.StripPrefix. Any query string
+// is kept, apart from parameters replaced by the hash path's query string.
+func redirect(w http.ResponseWriter, r *http.Request, from, to string, status int) {
+	//Hash paths include a query string when QueryStringMode is used.
+	from, _, _ = strings.Cut(from, "?")
+	to, toQuery, _ := strings.Cut(to, "?")
+
+	location := relativePath(path.Dir(from), to)
+	if !strings.HasPrefix(location, "../") {
+		//Prevent the first path segment from being treated as a URL scheme.
+		location = "./" + location
+	}
+	if query := mergeQuery(toQuery, r.URL.RawQuery); query != "" {
+		location += "?" + query
+	}
+
+	w.Header().Set("Location", location)
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(redirectMaxAge.Seconds())))
+	w.WriteHeader(status)
+}
@@ -0,0 +1,129 @@
+package hashfs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRedirectOriginalPaths(t *testing.T) {
+	mfs := fstest.MapFS{
+		"images/logo.png": {Data: []byte("png")},
+		"js/app.js":       {Data: []byte("console.log('app');")},
+	}
+
+	get := func(hfs *HFS, p string) *http.Response {
+		r := httptest.NewRequest("GET", p, nil)
+		w := httptest.NewRecorder()
+		http.StripPrefix("/static/", FileServer(hfs)).ServeHTTP(w, r)
+		return w.Result()
+	}
+
+	t.Run("Pattern", func(t *testing.T) {
+		hfs := NewFS(mfs, RedirectOriginalPaths(http.StatusFound, "images/*"))
+
+		res := get(hfs, "/static/images/logo.png?v=1")
+		if res.StatusCode != http.StatusFound {
+			t.Fatal("bad code", res.StatusCode)
+			return
+		}
+
+		want := "./" + path.Base(hfs.GetHashPath("images/logo.png")) + "?v=1"
+		if got := res.Header.Get("Location"); got != want {
+			t.Fatalf("bad location; \ngot:  %s, \nwant: %s", got, want)
+			return
+		}
+		if got := res.Header.Get("Cache-Control"); got != "public, max-age=60" {
+			t.Fatalf("bad cache-control; \ngot:  %s, \nwant: %s", got, "public, max-age=60")
+			return
+		}
+
+		//Files not matching a pattern are served as usual.
+		res = get(hfs, "/static/js/app.js")
+		if res.StatusCode != http.StatusOK {
+			t.Fatal("bad code", res.StatusCode)
+			return
+		}
+	})
+
+	t.Run("FilenamePattern", func(t *testing.T) {
+		//Patterns without a slash match nested files by filename.
+		hfs := NewFS(mfs, RedirectOriginalPaths(http.StatusFound, "*.png"))
+
+		res := get(hfs, "/static/images/logo.png")
+		if res.StatusCode != http.StatusFound {
+			t.Fatal("bad code", res.StatusCode)
+			return
+		}
+
+		res = get(hfs, "/static/js/app.js")
+		if res.StatusCode != http.StatusOK {
+			t.Fatal("bad code", res.StatusCode)
+			return
+		}
+
+		//Patterns with a slash only match the full path.
+		hfs = NewFS(mfs, RedirectOriginalPaths(http.StatusFound, "js/*.png"))
+		res = get(hfs, "/static/images/logo.png")
+		if res.StatusCode != http.StatusOK {
+			t.Fatal("bad code", res.StatusCode)
+			return
+		}
+	})
+
+	t.Run("HashPath", func(t *testing.T) {
+		hfs := NewFS(mfs, RedirectOriginalPaths(http.StatusTemporaryRedirect))
+
+		res := get(hfs, "/static/"+hfs.GetHashPath("js/app.js"))
+		if res.StatusCode != http.StatusOK {
+			t.Fatal("bad code", res.StatusCode)
+			return
+		}
+	})
+
+	t.Run("InvalidStatus", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected panic")
+			}
+		}()
+		NewFS(mfs, RedirectOriginalPaths(http.StatusMovedPermanently))
+	})
+}
+
+func TestRedirectStaleHashPaths(t *testing.T) {
+	mfs := fstest.MapFS{
+		"css/styles.css": {Data: []byte("body { color: pink; }")},
+	}
+	hfs := NewFS(mfs, RedirectStaleHashPaths(http.StatusTemporaryRedirect))
+	hashPath := hfs.GetHashPath("css/styles.css")
+	hash := hfs.hashPathReverse[hashPath].hash
+	stalePath := strings.Replace(hashPath, hash, strings.Repeat("0", len(hash)), 1)
+
+	r := httptest.NewRequest("GET", "/"+stalePath, nil)
+	w := httptest.NewRecorder()
+	FileServer(hfs).ServeHTTP(w, r)
+
+	res := w.Result()
+	if res.StatusCode != http.StatusTemporaryRedirect {
+		t.Fatal("bad code", res.StatusCode)
+		return
+	}
+	want := "./" + path.Base(hashPath)
+	if got := res.Header.Get("Location"); got != want {
+		t.Fatalf("bad location; \ngot:  %s, \nwant: %s", got, want)
+		return
+	}
+
+	//Paths that aren't hash paths still 404.
+	r = httptest.NewRequest("GET", "/css/missing.css", nil)
+	w = httptest.NewRecorder()
+	FileServer(hfs).ServeHTTP(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Fatal("bad code", w.Code)
+		return
+	}
+}
@@ -0,0 +1,272 @@
+package hashfs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RetentionStore stores the contents of hashed files so that they can be served by
+// FileServer after the file is no longer in the fs.FS, or its contents changed.
+//
+// This is helpful during rolling deploys when HTML rendered by one release of your
+// app requests hash paths from a replica running another release. Use a store that
+// is shared between replicas, i.e. a DirStore on a shared volume, so that each
+// release can serve the files of the others.
+type RetentionStore interface {
+	//Put stores the contents of the file at hashPath. This is called each time a
+	//file is hashed.
+	Put(hashPath string, content []byte) error
+
+	//Get returns the contents stored for hashPath. An error wrapping
+	//fs.ErrNotExist must be returned if nothing is stored for hashPath.
+	Get(hashPath string) ([]byte, error)
+}
+
+// Retain sets the RetentionStore that the contents of hashed files are stored in
+// and that FileServer falls back to when a requested hash path does not match any
+// file in the fs.FS. Retained files are served with the same aggressive caching
+// headers as any other hash path, but are not compressed.
+//
+// Files are stored when they are hashed, so use this with the Precompute option, or
+// call HFS.HashAll, to make sure every file is stored at startup. Retained files are
+// only served if their contents still match the hash in the hash path.
+//
+// This is ignored when DevMode is used.
+func Retain(store RetentionStore) optionFunc {
+	return func(hfs *HFS) {
+		hfs.retentionStore = store
+	}
+}
+
+// retain stores the contents of a hashed file in the RetentionStore, if one was
+// provided. Errors are ignored since they don't prevent the file from being served
+// from the fs.FS.
+func (hfs *HFS) retain(hashPath string, content []byte) {
+	if hfs.retentionStore == nil || hfs.devMode {
+		return
+	}
+
+	_ = hfs.retentionStore.Put(hashPath, content)
+}
+
+// serveRetained serves the contents of a hash path from the RetentionStore. True is
+// returned if the file was served. False is returned if no RetentionStore was
+// provided, the path is not a hash path, or nothing is retained for the path.
+func (hfs *HFS) serveRetained(w http.ResponseWriter, r *http.Request, hashPath string) bool {
+	if hfs.retentionStore == nil || hfs.devMode {
+		return false
+	}
+
+	originalPath, hash, ok := hfs.parseHashPath(hashPath)
+	if !ok {
+		return false
+	}
+
+	content, err := hfs.retentionStore.Get(hashPath)
+	if err != nil {
+		return false
+	}
+
+	//Make sure the retained contents weren't corrupted, or stored with a different
+	//hash algorithm, since these will be cached by browsers for a long time. This
+	//can't be checked when HashLocationTree is used since the hash in the hash path
+	//is not the hash of the file's contents.
+	contentHash := hfs.calculateHash(content)
+	if hfs.hashLocation != hashLocationTree && contentHash != hash {
+		return false
+	}
+
+	w.Header().Set("Cache-Control", hfs.getCacheControl())
+	w.Header().Set("ETag", entityTag(contentHash, ""))
+	http.ServeContent(w, r, originalPath, time.Time{}, bytes.NewReader(content))
+	return true
+}
+
+// DirStore is a RetentionStore that stores files in a directory on disk. Files are
+// stored in a subdirectory per release, i.e. Dir/Release/css/styles-a1b2c3.css, so
+// that old releases can be pruned.
+//
+// Releases are pruned the first time a file is stored. A release is kept if it is
+// one of the newest Releases releases or if a file was stored for it within MaxAge.
+// The current release is never pruned. If both Releases and MaxAge are zero, nothing
+// is pruned.
+type DirStore struct {
+	//Dir is the directory to store files in. This is created if needed.
+	Dir string
+
+	//Release identifies the release of your app, i.e. a version number or commit
+	//hash. Default is "default".
+	Release string
+
+	//Releases is the number of releases to keep files for, including the current
+	//release.
+	Releases int
+
+	//MaxAge is how long to keep files for a release after a file was last stored
+	//for it.
+	MaxAge time.Duration
+
+	pruneOnce sync.Once
+}
+
+// release returns the name of the current release's subdirectory.
+func (d *DirStore) release() string {
+	if d.Release == "" {
+		return "default"
+	}
+
+	return d.Release
+}
+
+// Put stores the contents of the file at hashPath for the current release. Files are
+// written to a temporary file and renamed so that a partially written file is never
+// served.
+func (d *DirStore) Put(hashPath string, content []byte) error {
+	if !fs.ValidPath(hashPath) {
+		return fmt.Errorf("hashfs: invalid path: %s", hashPath)
+	}
+
+	d.pruneOnce.Do(func() {
+		_ = d.Prune()
+	})
+
+	releaseDir := filepath.Join(d.Dir, d.release())
+	p := filepath.Join(releaseDir, filepath.FromSlash(hashPath))
+
+	//Files with the same hash path have the same contents, so there is no need to
+	//write the file again. Just mark the release as still in use.
+	now := time.Now()
+	if _, err := os.Stat(p); err == nil {
+		return os.Chtimes(releaseDir, now, now)
+	}
+
+	err := os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(content)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), p)
+	if err != nil {
+		return err
+	}
+
+	return os.Chtimes(releaseDir, now, now)
+}
+
+// Get returns the contents stored for hashPath, looking in the current release first
+// and then in every other release, newest first.
+func (d *DirStore) Get(hashPath string) ([]byte, error) {
+	if !fs.ValidPath(hashPath) {
+		return nil, fmt.Errorf("%w: %s", ErrNotExist, hashPath)
+	}
+
+	releases, err := d.releases()
+	if err != nil {
+		return nil, err
+	}
+
+	current := d.release()
+	sort.SliceStable(releases, func(i, j int) bool {
+		return releases[i].Name() == current && releases[j].Name() != current
+	})
+
+	for _, release := range releases {
+		b, err := os.ReadFile(filepath.Join(d.Dir, release.Name(), filepath.FromSlash(hashPath)))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		return b, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrNotExist, hashPath)
+}
+
+// Prune removes the files for releases that are no longer needed based on Releases
+// and MaxAge.
+func (d *DirStore) Prune() error {
+	if d.Releases <= 0 && d.MaxAge <= 0 {
+		return nil
+	}
+
+	releases, err := d.releases()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	kept := 1 //The current release is always kept.
+	for _, release := range releases {
+		if release.Name() == d.release() {
+			continue
+		}
+
+		keep := (d.Releases > 0 && kept < d.Releases) ||
+			(d.MaxAge > 0 && time.Since(release.ModTime()) < d.MaxAge)
+		if keep {
+			kept++
+			continue
+		}
+
+		err := os.RemoveAll(filepath.Join(d.Dir, release.Name()))
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// releases returns the info for each release's subdirectory, newest first.
+func (d *DirStore) releases() ([]fs.FileInfo, error) {
+	entries, err := os.ReadDir(d.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	releases := make([]fs.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		releases = append(releases, info)
+	}
+
+	sort.Slice(releases, func(i, j int) bool {
+		return releases[i].ModTime().After(releases[j].ModTime())
+	})
+	return releases, nil
+}
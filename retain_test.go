@@ -0,0 +1,169 @@
+package hashfs
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestDirStore(t *testing.T) {
+	t.Run("PutGet", func(t *testing.T) {
+		d := &DirStore{Dir: t.TempDir(), Release: "v1"}
+
+		err := d.Put("css/styles-abc.css", []byte("body {}"))
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		b, err := d.Get("css/styles-abc.css")
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if string(b) != "body {}" {
+			t.Fatalf("bad content; \ngot:  %s, \nwant: %s", b, "body {}")
+			return
+		}
+
+		_, err = d.Get("css/missing-abc.css")
+		if !errors.Is(err, ErrNotExist) {
+			t.Fatal("expected ErrNotExist", err)
+			return
+		}
+
+		_, err = d.Get("../css/styles-abc.css")
+		if !errors.Is(err, ErrNotExist) {
+			t.Fatal("expected ErrNotExist", err)
+			return
+		}
+	})
+
+	t.Run("OtherRelease", func(t *testing.T) {
+		dir := t.TempDir()
+		err := (&DirStore{Dir: dir, Release: "v1"}).Put("js/app-abc.js", []byte("v1"))
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		b, err := (&DirStore{Dir: dir, Release: "v2"}).Get("js/app-abc.js")
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		if string(b) != "v1" {
+			t.Fatalf("bad content; \ngot:  %s, \nwant: %s", b, "v1")
+			return
+		}
+	})
+
+	t.Run("Prune", func(t *testing.T) {
+		dir := t.TempDir()
+		old := time.Now().Add(-48 * time.Hour)
+		for i, release := range []string{"v1", "v2", "v3"} {
+			err := (&DirStore{Dir: dir, Release: release}).Put("js/app-abc.js", []byte(release))
+			if err != nil {
+				t.Fatal(err)
+				return
+			}
+
+			modTime := old.Add(time.Duration(i) * time.Hour)
+			err = os.Chtimes(filepath.Join(dir, release), modTime, modTime)
+			if err != nil {
+				t.Fatal(err)
+				return
+			}
+		}
+
+		//Keep the current release plus the newest other release.
+		d := &DirStore{Dir: dir, Release: "v4", Releases: 2, MaxAge: time.Hour}
+		err := d.Put("js/app-def.js", []byte("v4"))
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		for release, want := range map[string]bool{"v1": false, "v2": false, "v3": true, "v4": true} {
+			_, err := os.Stat(filepath.Join(dir, release))
+			if got := err == nil; got != want {
+				t.Fatalf("bad prune of %s; \ngot:  %t, \nwant: %t", release, got, want)
+				return
+			}
+		}
+	})
+}
+
+func TestRetain(t *testing.T) {
+	dir := t.TempDir()
+
+	//Release 1 hashes, and retains, the original file.
+	v1 := fstest.MapFS{
+		"js/app.js": {Data: []byte("console.log('v1');")},
+	}
+	hfs1 := NewFS(v1, Retain(&DirStore{Dir: dir, Release: "v1"}), Precompute())
+	oldHashPath := hfs1.GetHashPath("js/app.js")
+
+	//Release 2 has a different version of the file.
+	v2 := fstest.MapFS{
+		"js/app.js": {Data: []byte("console.log('v2');")},
+	}
+	hfs2 := NewFS(v2, Retain(&DirStore{Dir: dir, Release: "v2"}), Precompute())
+
+	get := func(hfs *HFS, p string) *http.Response {
+		r := httptest.NewRequest("GET", "/"+p, nil)
+		w := httptest.NewRecorder()
+		FileServer(hfs).ServeHTTP(w, r)
+		return w.Result()
+	}
+
+	t.Run("OldHashPath", func(t *testing.T) {
+		res := get(hfs2, oldHashPath)
+		if res.StatusCode != http.StatusOK {
+			t.Fatal("bad code", res.StatusCode)
+			return
+		}
+		body, _ := io.ReadAll(res.Body)
+		if string(body) != "console.log('v1');" {
+			t.Fatalf("bad content; \ngot:  %s, \nwant: %s", body, "console.log('v1');")
+			return
+		}
+		if got := res.Header.Get("Cache-Control"); got != hfs2.getCacheControl() {
+			t.Fatalf("bad cache-control; \ngot:  %s, \nwant: %s", got, hfs2.getCacheControl())
+			return
+		}
+	})
+
+	t.Run("NewHashPath", func(t *testing.T) {
+		res := get(hfs1, hfs2.GetHashPath("js/app.js"))
+		if res.StatusCode != http.StatusOK {
+			t.Fatal("bad code", res.StatusCode)
+			return
+		}
+		body, _ := io.ReadAll(res.Body)
+		if string(body) != "console.log('v2');" {
+			t.Fatalf("bad content; \ngot:  %s, \nwant: %s", body, "console.log('v2');")
+			return
+		}
+	})
+
+	t.Run("Corrupted", func(t *testing.T) {
+		err := os.WriteFile(filepath.Join(dir, "v1", filepath.FromSlash(oldHashPath)), []byte("corrupted"), 0644)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		res := get(hfs2, oldHashPath)
+		if res.StatusCode != http.StatusNotFound {
+			t.Fatal("bad code", res.StatusCode)
+			return
+		}
+	})
+}
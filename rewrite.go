@@ -0,0 +1,220 @@
+package hashfs
+
+import (
+	"errors"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// rewriteFunc rewrites references to other files within the contents of the file at
+// originalPath, replacing each reference with the referenced file's hash path. The
+// chain is passed to getHashPath when hashing referenced files to detect cycles.
+type rewriteFunc func(hfs *HFS, originalPath string, content []byte, chain []string) ([]byte, error)
+
+// rewrites returns true if the contents of the file at originalPath are rewritten.
+func (hfs *HFS) rewrites(originalPath string) bool {
+	//References already point to original paths in development mode.
+	if hfs.devMode {
+		return false
+	}
+
+	_, exists := hfs.rewriters[path.Ext(originalPath)]
+	return exists
+}
+
+// addRewriter registers a rewriteFunc for the given file extensions.
+func (hfs *HFS) addRewriter(rewrite rewriteFunc, exts ...string) {
+	if hfs.rewriters == nil {
+		hfs.rewriters = make(map[string]rewriteFunc)
+	}
+
+	for _, ext := range exts {
+		hfs.rewriters[ext] = rewrite
+	}
+}
+
+// schemeRegexp matches a URL that starts with a scheme, i.e. https: or data:.
+var schemeRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:`)
+
+// rewriteReference returns the reference, found within the file at originalPath,
+// with the path replaced by the referenced file's hash path. The referenced file is
+// hashed if needed.
+//
+// References that are external (i.e. have a scheme or start with //), are fragment
+// only, point outside of the fs.FS, or point to files that do not exist are returned
+// as-is since there is nothing to cache-bust. Any query string or fragment is kept.
+//
+// Absolute references are resolved from the root of the fs.FS, or from the URL
+// prefix if the URLPrefix option was provided, and are returned as absolute.
+// Relative references are resolved from the directory of originalPath and are
+// returned relative to the directory of originalPath's hash path, since that is
+// where the browser resolves them from.
+func (hfs *HFS) rewriteReference(originalPath, ref string, chain []string) (string, error) {
+	//Skip references we can't, or shouldn't, rewrite.
+	if ref == "" || strings.HasPrefix(ref, "#") || strings.HasPrefix(ref, "//") || schemeRegexp.MatchString(ref) {
+		return ref, nil
+	}
+
+	//Separate any query string or fragment.
+	refPath, suffix := ref, ""
+	if i := strings.IndexAny(ref, "?#"); i != -1 {
+		refPath, suffix = ref[:i], ref[i:]
+	}
+	if refPath == "" {
+		return ref, nil
+	}
+
+	//Resolve the referenced file's original path.
+	//
+	//Absolute references must start with the URL prefix, if one was provided, since
+	//anything else is not served from the fs.FS.
+	absolute := strings.HasPrefix(refPath, "/")
+	var refOriginalPath string
+	if absolute && hfs.urlPrefix != "" {
+		trimmed, found := strings.CutPrefix(refPath, hfs.urlPrefix)
+		if !found {
+			return ref, nil
+		}
+		refOriginalPath = path.Clean(trimmed)
+	} else if absolute {
+		refOriginalPath = path.Clean(strings.TrimPrefix(refPath, "/"))
+	} else {
+		refOriginalPath = path.Join(path.Dir(originalPath), refPath)
+	}
+	if refOriginalPath == ".." || strings.HasPrefix(refOriginalPath, "../") {
+		return ref, nil
+	}
+
+	//Get the referenced file's hash path. References to files that don't exist are
+	//left as-is since the file may be served by something other than this fs.FS.
+	refHashPath, err := hfs.getHashPath(refOriginalPath, chain)
+	if errors.Is(err, ErrNotExist) || errors.Is(err, ErrIsDir) {
+		return ref, nil
+	} else if err != nil {
+		return "", err
+	}
+
+	if absolute && hfs.urlPrefix != "" {
+		return joinQuery(hfs.addURLPrefix(refHashPath), suffix, "&"), nil
+	} else if absolute {
+		return joinQuery("/"+refHashPath, suffix, "&"), nil
+	}
+	return joinQuery(relativePath(hfs.hashPathDir(originalPath), refHashPath), suffix, "&"), nil
+}
+
+// relativePath returns the path to target relative to the directory dir. Both dir
+// and target are slash-separated paths relative to the root of the fs.FS.
+func relativePath(dir, target string) string {
+	var dirParts []string
+	if dir != "." && dir != "" {
+		dirParts = strings.Split(dir, "/")
+	}
+	targetParts := strings.Split(target, "/")
+
+	//Remove the common leading directories.
+	i := 0
+	for i < len(dirParts) && i < len(targetParts)-1 && dirParts[i] == targetParts[i] {
+		i++
+	}
+
+	parts := make([]string, 0, len(dirParts)-i+len(targetParts)-i)
+	for range dirParts[i:] {
+		parts = append(parts, "..")
+	}
+	parts = append(parts, targetParts[i:]...)
+
+	return strings.Join(parts, "/")
+}
+
+// cssRegexp matches references to other files in CSS. The first submatch is a
+// url() reference, the second is a quoted @import reference. url() references may be
+// quoted or unquoted, and quotes are included in the submatch.
+var cssRegexp = regexp.MustCompile(`(?i)url\(\s*("[^"]*"|'[^']*'|[^'"\s)]+)\s*\)|@import\s+("[^"]*"|'[^']*')`)
+
+// RewriteCSS causes references to other files within CSS files, in url() and
+// @import, to be replaced with the referenced files' hash paths. The hash of each
+// CSS file is calculated from the rewritten contents, so a change to a referenced
+// file, such as a font or image, also changes the hash path of the CSS file. The
+// rewritten contents are served by FileServer.
+//
+// Relative references are resolved from the CSS file's directory. Absolute
+// references are resolved from the root of the fs.FS.
+func RewriteCSS() optionFunc {
+	return func(hfs *HFS) {
+		hfs.addRewriter((*HFS).rewriteCSS, ".css")
+	}
+}
+
+// rewriteCSS is the rewriteFunc for CSS files.
+func (hfs *HFS) rewriteCSS(originalPath string, content []byte, chain []string) ([]byte, error) {
+	return hfs.rewriteMatches(cssRegexp, originalPath, content, chain)
+}
+
+// rewriteMatches rewrites each reference matched by re within content. Each
+// submatch of re is a possible reference, which may be quoted; the first submatch
+// that matched is used.
+func (hfs *HFS) rewriteMatches(re *regexp.Regexp, originalPath string, content []byte, chain []string) ([]byte, error) {
+	var (
+		b    strings.Builder
+		last int
+	)
+	for _, m := range re.FindAllSubmatchIndex(content, -1) {
+		//Find the submatch that matched.
+		start, end := -1, -1
+		for i := 2; i < len(m); i += 2 {
+			if m[i] != -1 {
+				start, end = m[i], m[i+1]
+				break
+			}
+		}
+		if start == -1 {
+			continue
+		}
+
+		//Remove quotes.
+		if c := content[start]; (c == '"' || c == '\'') && end-start >= 2 {
+			start++
+			end--
+		}
+
+		rewritten, err := hfs.rewriteReference(originalPath, string(content[start:end]), chain)
+		if err != nil {
+			return nil, err
+		}
+
+		b.Write(content[last:start])
+		b.WriteString(rewritten)
+		last = end
+	}
+	b.Write(content[last:])
+
+	return []byte(b.String()), nil
+}
+
+// jsRegexp matches references to other files in JavaScript. The first submatch is
+// the specifier of a static import or export with a from clause, the second is the
+// specifier of a side-effect import, the third is a sourceMappingURL comment.
+// Specifiers are quoted and only relative or absolute specifiers are matched; bare
+// specifiers, i.e. "lodash", refer to packages rather than files.
+var jsRegexp = regexp.MustCompile(`\b(?:import|export)\b[^'";]*?\bfrom\s*("\.{0,2}/[^"\n]*"|'\.{0,2}/[^'\n]*')|\bimport\s*("\.{0,2}/[^"\n]*"|'\.{0,2}/[^'\n]*')|(?m:^[ \t]*//[#@][ \t]*sourceMappingURL=(\S+))`)
+
+// RewriteJS causes the specifiers of static import and export statements within
+// JavaScript files, and sourceMappingURL comments, to be replaced with the referenced
+// files' hash paths. The hash of each JavaScript file is calculated from the
+// rewritten contents, so a change to an imported module also changes the hash path
+// of each module that imports it. The rewritten contents are served by FileServer.
+//
+// Only relative (./ or ../) and absolute (/) specifiers are rewritten. Since each
+// module is hashed after the modules it imports, import cycles cannot be hashed and
+// an error wrapping ErrCycle is returned from GetHashPathE.
+func RewriteJS() optionFunc {
+	return func(hfs *HFS) {
+		hfs.addRewriter((*HFS).rewriteJS, ".js", ".mjs")
+	}
+}
+
+// rewriteJS is the rewriteFunc for JavaScript files.
+func (hfs *HFS) rewriteJS(originalPath string, content []byte, chain []string) ([]byte, error) {
+	return hfs.rewriteMatches(jsRegexp, originalPath, content, chain)
+}
@@ -0,0 +1,256 @@
+package hashfs
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRelativePath(t *testing.T) {
+	tests := []struct {
+		dir, target, want string
+	}{
+		{".", "a.css", "a.css"},
+		{"css", "css/a.css", "a.css"},
+		{"css", "fonts/a.woff2", "../fonts/a.woff2"},
+		{"css/sub", "fonts/a.woff2", "../../fonts/a.woff2"},
+		{"css", "css/sub/a.png", "sub/a.png"},
+		{"css", "a.png", "../a.png"},
+	}
+
+	for _, tt := range tests {
+		got := relativePath(tt.dir, tt.target)
+		if got != tt.want {
+			t.Fatalf("bad relative path for %s, %s; \ngot:  %s, \nwant: %s", tt.dir, tt.target, got, tt.want)
+			return
+		}
+	}
+}
+
+func TestRewriteCSS(t *testing.T) {
+	mfs := fstest.MapFS{
+		"css/styles.css": {Data: []byte(`@import "base.css";
+@font-face { src: url(../fonts/x.woff2) format("woff2"), url('../fonts/x.woff?#iefix'); }
+body { background: url("/img/bg.png?v=1"); }
+.a { background: url(data:image/png;base64,AAAA); }
+.b { background: url(https://example.com/a.png); }
+.c { background: url(missing.png); }
+.d { background: url(../../outside.png); }
+`)},
+		"css/styles.css.gz": {Data: []byte("gzip")},
+		"css/base.css":      {Data: []byte(`body { color: pink; }`)},
+		"fonts/x.woff2":     {Data: []byte("woff2")},
+		"fonts/x.woff":      {Data: []byte("woff")},
+		"img/bg.png":        {Data: []byte("png")},
+	}
+
+	hfs := NewFS(mfs, RewriteCSS(), HashLength(8))
+
+	hashPath, err := hfs.GetHashPathE("css/styles.css")
+	if err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	want := `@import "` + relativePath("css", hfs.GetHashPath("css/base.css")) + `";
+@font-face { src: url(` + relativePath("css", hfs.GetHashPath("fonts/x.woff2")) + `) format("woff2"), url('` + relativePath("css", hfs.GetHashPath("fonts/x.woff")) + `?#iefix'); }
+body { background: url("/` + hfs.GetHashPath("img/bg.png") + `?v=1"); }
+.a { background: url(data:image/png;base64,AAAA); }
+.b { background: url(https://example.com/a.png); }
+.c { background: url(missing.png); }
+.d { background: url(../../outside.png); }
+`
+
+	t.Run("Content", func(t *testing.T) {
+		rev := hfs.hashPathReverse[hashPath]
+		if string(rev.content) != want {
+			t.Fatalf("bad rewritten content; \ngot:  %s, \nwant: %s", rev.content, want)
+			return
+		}
+		if rev.hash != hfs.calculateHash([]byte(want)) {
+			t.Fatal("hash not calculated from rewritten content")
+			return
+		}
+	})
+
+	t.Run("FileServer", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/"+hashPath, nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		FileServer(hfs).ServeHTTP(w, r)
+
+		res := w.Result()
+		if res.StatusCode != http.StatusOK {
+			t.Fatal("bad code", res.StatusCode)
+			return
+		}
+
+		body, _ := io.ReadAll(res.Body)
+		if string(body) != want {
+			t.Fatalf("bad content; \ngot:  %s, \nwant: %s", body, want)
+			return
+		}
+		if got := res.Header.Get("Content-Encoding"); got != "" {
+			t.Fatalf("precompressed file should not be served; \ngot:  %s, \nwant: %s", got, "")
+			return
+		}
+	})
+
+	t.Run("ReferenceChangesHash", func(t *testing.T) {
+		changed := fstest.MapFS{}
+		for k, v := range mfs {
+			changed[k] = v
+		}
+		changed["fonts/x.woff2"] = &fstest.MapFile{Data: []byte("new woff2")}
+
+		hfs2 := NewFS(changed, RewriteCSS(), HashLength(8))
+		if hfs2.GetHashPath("css/styles.css") == hashPath {
+			t.Fatal("hash path should change when a referenced file changes")
+			return
+		}
+	})
+
+	t.Run("Manifest", func(t *testing.T) {
+		err := hfs.HashAll()
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		loaded, err := NewFSFromManifest(mfs, hfs.Manifest(), RewriteCSS(), HashLength(8), VerifyManifest(0))
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		f, err := loaded.Open(hashPath)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+		defer f.Close()
+
+		body, _ := io.ReadAll(f)
+		if string(body) != want {
+			t.Fatalf("bad content; \ngot:  %s, \nwant: %s", body, want)
+			return
+		}
+	})
+
+	t.Run("Cycle", func(t *testing.T) {
+		cycle := fstest.MapFS{
+			"a.css": {Data: []byte(`@import "b.css";`)},
+			"b.css": {Data: []byte(`@import url(a.css);`)},
+		}
+		hfs := NewFS(cycle, RewriteCSS())
+
+		_, err := hfs.GetHashPathE("a.css")
+		if !errors.Is(err, ErrCycle) {
+			t.Fatal("expected ErrCycle", err)
+			return
+		}
+	})
+
+	t.Run("URLPrefix", func(t *testing.T) {
+		prefixed := fstest.MapFS{
+			"css/styles.css": {Data: []byte(`a { background: url(/static/img/bg.png); } b { background: url(/img/bg.png); }`)},
+			"img/bg.png":     {Data: []byte("png")},
+		}
+		hfs := NewFS(prefixed, RewriteCSS(), URLPrefix("/static/"))
+
+		hashPath, err := hfs.GetHashPathE("css/styles.css")
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		rev := hfs.hashPathReverse[strings.TrimPrefix(hashPath, "/static/")]
+		want := `a { background: url(` + hfs.GetHashPath("img/bg.png") + `); } b { background: url(/img/bg.png); }`
+		if string(rev.content) != want {
+			t.Fatalf("bad rewritten content; \ngot:  %s, \nwant: %s", rev.content, want)
+			return
+		}
+	})
+}
+
+func TestRewriteJS(t *testing.T) {
+	mfs := fstest.MapFS{
+		"js/app.js": {Data: []byte(`import { a, b as c } from "./util.js";
+import def from '../lib/def.mjs';
+import "./side.js";
+import x from "lodash";
+export * from "./util.js";
+export { d } from "/js/util.js";
+const s = "./util.js";
+const m = await import("./lazy.js");
+//# sourceMappingURL=app.js.map
+`)},
+		"js/util.js":     {Data: []byte(`export const a = 1;`)},
+		"js/side.js":     {Data: []byte(`console.log("side");`)},
+		"js/lazy.js":     {Data: []byte(`export default 1;`)},
+		"js/app.js.map":  {Data: []byte(`{}`)},
+		"lib/def.mjs":    {Data: []byte(`export default 1;`)},
+		"js/cycle-a.js":  {Data: []byte(`import "./cycle-b.js";`)},
+		"js/cycle-b.js":  {Data: []byte(`import { a } from "./cycle-a.js";`)},
+		"css/styles.css": {Data: []byte(`body { background: url(../img/x.png); }`)},
+	}
+
+	hfs := NewFS(mfs, RewriteJS(), HashLength(8))
+
+	t.Run("Content", func(t *testing.T) {
+		hashPath, err := hfs.GetHashPathE("js/app.js")
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		util := relativePath("js", hfs.GetHashPath("js/util.js"))
+		want := `import { a, b as c } from "` + util + `";
+import def from '` + relativePath("js", hfs.GetHashPath("lib/def.mjs")) + `';
+import "` + relativePath("js", hfs.GetHashPath("js/side.js")) + `";
+import x from "lodash";
+export * from "` + util + `";
+export { d } from "/` + hfs.GetHashPath("js/util.js") + `";
+const s = "./util.js";
+const m = await import("./lazy.js");
+//# sourceMappingURL=` + relativePath("js", hfs.GetHashPath("js/app.js.map")) + `
+`
+
+		rev := hfs.hashPathReverse[hashPath]
+		if string(rev.content) != want {
+			t.Fatalf("bad rewritten content; \ngot:  %s, \nwant: %s", rev.content, want)
+			return
+		}
+
+		//Served content should be rewritten.
+		r := httptest.NewRequest("GET", "/"+hashPath, nil)
+		w := httptest.NewRecorder()
+		FileServer(hfs).ServeHTTP(w, r)
+
+		body, _ := io.ReadAll(w.Result().Body)
+		if string(body) != want {
+			t.Fatalf("bad content; \ngot:  %s, \nwant: %s", body, want)
+			return
+		}
+	})
+
+	t.Run("Cycle", func(t *testing.T) {
+		_, err := hfs.GetHashPathE("js/cycle-a.js")
+		if !errors.Is(err, ErrCycle) {
+			t.Fatal("expected ErrCycle", err)
+			return
+		}
+	})
+
+	t.Run("CSSNotRewritten", func(t *testing.T) {
+		hashPath := hfs.GetHashPath("css/styles.css")
+		if rev := hfs.hashPathReverse[hashPath]; rev.content != nil {
+			t.Fatal("CSS should not be rewritten without RewriteCSS")
+			return
+		}
+	})
+}
@@ -0,0 +1,252 @@
+package hashfs
+
+import (
+	"errors"
+	"io/fs"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Change describes a file whose hash path was invalidated by Watch because the file
+// was modified or removed.
+type Change struct {
+	//OriginalPath is the path to the file in the fs.FS.
+	OriginalPath string
+
+	//HashPath is the hash path, in the fs.FS, that was in use before the file
+	//changed. This hash path is no longer served.
+	HashPath string
+
+	//Removed is true if the file no longer exists.
+	Removed bool
+}
+
+// Invalidate removes the cached hash path for the file at originalPath so that the
+// hash is recalculated from the file's current contents the next time GetHashPath
+// is called. This is useful when the fs.FS is an os.DirFS and a file was edited
+// while your binary is running.
+//
+// The old hash path is no longer served by FileServer. Files whose contents are
+// rewritten, i.e. when RewriteCSS is used, are invalidated as well since they may
+// reference the invalidated file. When HashLocationTree is used, every file is
+// invalidated since every hash path includes the hash of every file.
+//
+// If the URLPrefix option was provided, the originalPath may be a full URL path.
+func (hfs *HFS) Invalidate(originalPath string) {
+	originalPath = hfs.trimURLPrefix(originalPath)
+
+	hfs.mu.Lock()
+	defer hfs.mu.Unlock()
+
+	hashPath, exists := hfs.originalPathToHashPath[originalPath]
+	if !exists {
+		return
+	}
+
+	hfs.invalidate(originalPath, hashPath)
+}
+
+// invalidate removes the entries for a file from the lookup tables and from the
+// cache of compressed files. Entries for files whose contents are rewritten are
+// removed too since their contents, and thus their hashes, depend on the hash paths
+// of other files.
+//
+// hfs.mu must be locked by the caller.
+func (hfs *HFS) invalidate(originalPath, hashPath string) {
+	//Every hash path changes when any file changes when HashLocationTree is used.
+	if hfs.hashLocation == hashLocationTree && hfs.filenamePattern == nil {
+		hfs.originalPathToHashPath = make(map[string]string)
+		hfs.hashPathReverse = make(map[string]reverse)
+		hfs.resetTree()
+		hfs.resetCompressCache()
+		return
+	}
+
+	hashPaths := []string{hashPath}
+	delete(hfs.originalPathToHashPath, originalPath)
+	delete(hfs.hashPathReverse, hashPath)
+
+	for hp, rev := range hfs.hashPathReverse {
+		if hfs.rewrites(rev.originalPath) {
+			hashPaths = append(hashPaths, hp)
+			delete(hfs.originalPathToHashPath, rev.originalPath)
+			delete(hfs.hashPathReverse, hp)
+		}
+	}
+
+	hfs.compressMu.Lock()
+	for _, hp := range hashPaths {
+		hfs.compressCacheUsed -= uint(len(hfs.compressCache[hp]))
+		delete(hfs.compressCache, hp)
+	}
+	hfs.compressMu.Unlock()
+}
+
+// Reset removes every cached hash path, and compressed file, so that each file's
+// hash is recalculated the next time GetHashPath is called. Old hash paths are no
+// longer served by FileServer.
+func (hfs *HFS) Reset() {
+	hfs.mu.Lock()
+	hfs.originalPathToHashPath = make(map[string]string)
+	hfs.hashPathReverse = make(map[string]reverse)
+	hfs.mu.Unlock()
+
+	hfs.resetTree()
+	hfs.resetCompressCache()
+}
+
+// resetTree removes the tree hash so that it is recalculated when next needed.
+func (hfs *HFS) resetTree() {
+	hfs.treeMu.Lock()
+	hfs.tree = ""
+	hfs.treeMu.Unlock()
+}
+
+// resetCompressCache removes every compressed file from the cache.
+func (hfs *HFS) resetCompressCache() {
+	hfs.compressMu.Lock()
+	if hfs.compressCache != nil {
+		hfs.compressCache = make(map[string][]byte)
+	}
+	hfs.compressCacheUsed = 0
+	hfs.compressMu.Unlock()
+}
+
+// Watch checks the files in the lookup tables for changes every interval and calls
+// Invalidate for each file that was modified or removed. This is meant for use with
+// an os.DirFS during development, or when files are deployed without restarting
+// your binary, so that edits are picked up automatically.
+//
+// Changes are detected by comparing the size and modification time returned by
+// fs.Stat with the values from when the hash was calculated. For files loaded from
+// a manifest, the first check records these values.
+//
+// onChange, if not nil, is called for each file that was invalidated. This is
+// called from the watching goroutine, so don't block for long.
+//
+// Call the returned stop func to stop watching. stop waits for any in-progress
+// check to finish.
+//
+// This will panic if the interval is not positive.
+func (hfs *HFS) Watch(interval time.Duration, onChange func(Change)) (stop func()) {
+	if interval <= 0 {
+		panic("non-positive watch interval")
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				for _, c := range hfs.checkChanges() {
+					if onChange != nil {
+						onChange(c)
+					}
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+		})
+		<-stopped
+	}
+}
+
+// checkChanges stats each file in the lookup tables and invalidates any file that
+// was modified or removed since its hash was calculated. The changes are returned
+// sorted by original path.
+func (hfs *HFS) checkChanges() (changes []Change) {
+	//Get the list of files to check. The lock isn't held while stat-ing files so
+	//that GetHashPath and FileServer aren't blocked.
+	type entry struct {
+		originalPath string
+		hashPath     string
+		info         fs.FileInfo
+	}
+
+	hfs.mu.RLock()
+	entries := make([]entry, 0, len(hfs.originalPathToHashPath))
+	for originalPath, hashPath := range hfs.originalPathToHashPath {
+		entries = append(entries, entry{
+			originalPath: originalPath,
+			hashPath:     hashPath,
+			info:         hfs.hashPathReverse[hashPath].info,
+		})
+	}
+	hfs.mu.RUnlock()
+
+	//Stat every file before invalidating any of them. With HashLocationTree,
+	//invalidating one file invalidates every file, so the other changed files must
+	//be found first to be reported.
+	type result struct {
+		entry
+		info    fs.FileInfo
+		removed bool
+	}
+	results := make([]result, 0, len(entries))
+	for _, e := range entries {
+		info, err := fs.Stat(hfs.fsys, e.originalPath)
+		removed := errors.Is(err, fs.ErrNotExist)
+		if err != nil && !removed {
+			//Some other, possibly temporary, error occured. Try again next time.
+			continue
+		}
+
+		results = append(results, result{e, info, removed})
+	}
+
+	hfs.mu.Lock()
+	defer hfs.mu.Unlock()
+
+	for _, r := range results {
+		//Make sure the entry wasn't invalidated, or replaced, while we weren't
+		//holding the lock.
+		if hfs.originalPathToHashPath[r.originalPath] != r.hashPath {
+			continue
+		}
+
+		switch {
+		case !r.removed && r.entry.info == nil:
+			//Nothing to compare against, i.e. the entry was loaded from a manifest.
+			//Record the file's info to compare against next time.
+			rev := hfs.hashPathReverse[r.hashPath]
+			rev.info = r.info
+			hfs.hashPathReverse[r.hashPath] = rev
+
+		case r.removed || r.info.Size() != r.entry.info.Size() || !r.info.ModTime().Equal(r.entry.info.ModTime()):
+			changes = append(changes, Change{
+				OriginalPath: r.originalPath,
+				HashPath:     r.hashPath,
+				Removed:      r.removed,
+			})
+		}
+	}
+
+	//Invalidate the changed files. An entry may already have been invalidated by
+	//an earlier one, i.e. a CSS file importing a changed file, or every file when
+	//HashLocationTree is used.
+	for _, c := range changes {
+		if hfs.originalPathToHashPath[c.OriginalPath] == c.HashPath {
+			hfs.invalidate(c.OriginalPath, c.HashPath)
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].OriginalPath < changes[j].OriginalPath
+	})
+	return
+}
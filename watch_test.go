@@ -0,0 +1,248 @@
+package hashfs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestInvalidate(t *testing.T) {
+	mfs := fstest.MapFS{
+		"css/styles.css": {Data: []byte(`@import "base.css";`)},
+		"css/base.css":   {Data: []byte(`body { color: pink; }`)},
+		"js/script.js":   {Data: []byte(`console.log("hello");`)},
+	}
+	hfs := NewFS(mfs, RewriteCSS())
+
+	stylesHashPath := hfs.GetHashPath("css/styles.css")
+	baseHashPath := hfs.GetHashPath("css/base.css")
+	scriptHashPath := hfs.GetHashPath("js/script.js")
+
+	mfs["css/base.css"] = &fstest.MapFile{Data: []byte(`body { color: blue; }`)}
+	hfs.Invalidate("css/base.css")
+
+	t.Run("Tables", func(t *testing.T) {
+		if _, exists := hfs.hashPathReverse[baseHashPath]; exists {
+			t.Fatal("invalidated file still in reverse lookup table")
+			return
+		}
+		if _, exists := hfs.hashPathReverse[stylesHashPath]; exists {
+			t.Fatal("rewritten file referencing invalidated file still in reverse lookup table")
+			return
+		}
+		if _, exists := hfs.hashPathReverse[scriptHashPath]; !exists {
+			t.Fatal("unrelated file should not be invalidated")
+			return
+		}
+	})
+
+	t.Run("Rehash", func(t *testing.T) {
+		newBaseHashPath := hfs.GetHashPath("css/base.css")
+		if newBaseHashPath == baseHashPath {
+			t.Fatal("hash path not recalculated")
+			return
+		}
+
+		rev := hfs.hashPathReverse[hfs.GetHashPath("css/styles.css")]
+		want := `@import "` + relativePath("css", newBaseHashPath) + `";`
+		if string(rev.content) != want {
+			t.Fatalf("bad rewritten content; \ngot:  %s, \nwant: %s", rev.content, want)
+			return
+		}
+	})
+
+	t.Run("OldHashPath", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/"+baseHashPath, nil)
+		w := httptest.NewRecorder()
+		FileServer(hfs).ServeHTTP(w, r)
+
+		if w.Code != http.StatusNotFound {
+			t.Fatal("bad code", w.Code)
+			return
+		}
+	})
+
+	t.Run("WriteBack", func(t *testing.T) {
+		//Lazily calculated information must not bring back an invalidated hash
+		//path, i.e. when Invalidate runs while integrity is being calculated.
+		hashPath := hfs.GetHashPath("js/script.js")
+		rev := hfs.hashPathReverse[hashPath]
+		hfs.Invalidate("js/script.js")
+
+		rev.integrity = "sha384-x"
+		if hfs.updateReverse(hashPath, rev) {
+			t.Fatal("invalidated hash path should not be stored")
+			return
+		}
+		if _, exists := hfs.hashPathReverse[hashPath]; exists {
+			t.Fatal("invalidated hash path brought back")
+			return
+		}
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		hfs.Reset()
+		if len(hfs.originalPathToHashPath) != 0 || len(hfs.hashPathReverse) != 0 {
+			t.Fatal("lookup tables not reset")
+			return
+		}
+	})
+}
+
+func TestWatch(t *testing.T) {
+	modTime := time.Now()
+	mfs := fstest.MapFS{
+		"css/styles.css": {Data: []byte(`body { color: pink; }`), ModTime: modTime},
+		"js/script.js":   {Data: []byte(`console.log("hello");`), ModTime: modTime},
+		"js/other.js":    {Data: []byte(`console.log("other");`), ModTime: modTime},
+	}
+
+	t.Run("CheckChanges", func(t *testing.T) {
+		hfs := NewFS(mfs)
+		stylesHashPath := hfs.GetHashPath("css/styles.css")
+		scriptHashPath := hfs.GetHashPath("js/script.js")
+		hfs.GetHashPath("js/other.js")
+
+		if changes := hfs.checkChanges(); len(changes) != 0 {
+			t.Fatal("unexpected changes", changes)
+			return
+		}
+
+		//Same size, different modification time.
+		mfs["css/styles.css"] = &fstest.MapFile{Data: []byte(`body { color: blue; }`), ModTime: modTime.Add(time.Second)}
+		delete(mfs, "js/script.js")
+
+		changes := hfs.checkChanges()
+		want := []Change{
+			{OriginalPath: "css/styles.css", HashPath: stylesHashPath},
+			{OriginalPath: "js/script.js", HashPath: scriptHashPath, Removed: true},
+		}
+		if len(changes) != len(want) {
+			t.Fatalf("bad changes; \ngot:  %v, \nwant: %v", changes, want)
+			return
+		}
+		for i := range want {
+			if changes[i] != want[i] {
+				t.Fatalf("bad change; \ngot:  %v, \nwant: %v", changes[i], want[i])
+				return
+			}
+		}
+
+		if hfs.GetHashPath("css/styles.css") == stylesHashPath {
+			t.Fatal("hash path not recalculated")
+			return
+		}
+	})
+
+	t.Run("Tree", func(t *testing.T) {
+		tfs := fstest.MapFS{
+			"css/styles.css": {Data: []byte(`body { color: pink; }`), ModTime: modTime},
+			"js/script.js":   {Data: []byte(`console.log("hello");`), ModTime: modTime},
+			"js/other.js":    {Data: []byte(`console.log("other");`), ModTime: modTime},
+		}
+		hfs := NewFS(tfs, HashLocationTree())
+		stylesHashPath := hfs.GetHashPath("css/styles.css")
+		scriptHashPath := hfs.GetHashPath("js/script.js")
+		hfs.GetHashPath("js/other.js")
+
+		//Invalidating one file invalidates every file, but every changed file must
+		//still be reported.
+		tfs["css/styles.css"] = &fstest.MapFile{Data: []byte(`body { color: blue; }`), ModTime: modTime.Add(time.Second)}
+		tfs["js/script.js"] = &fstest.MapFile{Data: []byte(`console.log("hi");`), ModTime: modTime.Add(time.Second)}
+
+		changes := hfs.checkChanges()
+		want := []Change{
+			{OriginalPath: "css/styles.css", HashPath: stylesHashPath},
+			{OriginalPath: "js/script.js", HashPath: scriptHashPath},
+		}
+		if len(changes) != len(want) {
+			t.Fatalf("bad changes; \ngot:  %v, \nwant: %v", changes, want)
+			return
+		}
+		for i := range want {
+			if changes[i] != want[i] {
+				t.Fatalf("bad change; \ngot:  %v, \nwant: %v", changes[i], want[i])
+				return
+			}
+		}
+
+		//The new info is recorded when rehashed, so nothing is reported again.
+		hfs.GetHashPath("css/styles.css")
+		hfs.GetHashPath("js/script.js")
+		if changes := hfs.checkChanges(); len(changes) != 0 {
+			t.Fatal("unexpected changes", changes)
+			return
+		}
+	})
+
+	t.Run("Manifest", func(t *testing.T) {
+		m := NewFS(mfs, Precompute()).Manifest()
+		hfs, err := NewFSFromManifest(mfs, m)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		//First check only records each file's info.
+		if changes := hfs.checkChanges(); len(changes) != 0 {
+			t.Fatal("unexpected changes", changes)
+			return
+		}
+
+		mfs["js/other.js"] = &fstest.MapFile{Data: []byte(`console.log("changed");`), ModTime: modTime}
+		changes := hfs.checkChanges()
+		if len(changes) != 1 || changes[0].OriginalPath != "js/other.js" {
+			t.Fatal("bad changes", changes)
+			return
+		}
+	})
+
+	t.Run("BadInterval", func(t *testing.T) {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatal("expected panic for non-positive interval")
+			}
+		}()
+		NewFS(mfs).Watch(0, nil)
+	})
+
+	t.Run("Callback", func(t *testing.T) {
+		dir := t.TempDir()
+		p := filepath.Join(dir, "styles.css")
+		err := os.WriteFile(p, []byte(`body { color: pink; }`), 0644)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		hfs := NewFS(os.DirFS(dir))
+		hfs.GetHashPath("styles.css")
+
+		changed := make(chan Change, 1)
+		stop := hfs.Watch(time.Millisecond, func(c Change) {
+			changed <- c
+		})
+		defer stop()
+
+		err = os.WriteFile(p, []byte(`body { color: green; }`), 0644)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		select {
+		case c := <-changed:
+			if c.OriginalPath != "styles.css" {
+				t.Fatalf("bad change; \ngot:  %s, \nwant: %s", c.OriginalPath, "styles.css")
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("change not detected")
+			return
+		}
+	})
+}